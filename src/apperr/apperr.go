@@ -0,0 +1,103 @@
+package apperr
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+type Kind int
+
+const (
+	Internal Kind = iota
+	Validation
+	NotFound
+	Conflict
+	Unauthorized
+	Forbidden
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error that knows how it should be reported to a client. Code
+// is a stable machine-readable identifier; Message is meant for humans.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func NewValidation(code string, message string, fields ...FieldError) *Error {
+	return &Error{Kind: Validation, Code: code, Message: message, Fields: fields}
+}
+
+func NewNotFound(code string, message string) *Error {
+	return &Error{Kind: NotFound, Code: code, Message: message}
+}
+
+func NewConflict(code string, message string, fields ...FieldError) *Error {
+	return &Error{Kind: Conflict, Code: code, Message: message, Fields: fields}
+}
+
+func NewUnauthorized(code string, message string) *Error {
+	return &Error{Kind: Unauthorized, Code: code, Message: message}
+}
+
+func NewForbidden(code string, message string) *Error {
+	return &Error{Kind: Forbidden, Code: code, Message: message}
+}
+
+func NewInternal(err error) *Error {
+	return &Error{Kind: Internal, Code: "internal", Message: "internal error", Err: err}
+}
+
+// From classifies an error returned by the repository. A missing record is
+// reported as NotFound with the given message; constraint violations become
+// Conflict or Validation errors and everything else is Internal.
+func From(err error, notFound string) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NewNotFound("not_found", notFound).Wrap(err)
+	}
+
+	var sqlErr *mysql.MySQLError
+	if errors.As(err, &sqlErr) {
+		switch sqlErr.Number {
+		case 1062:
+			return NewConflict("duplicate", "record already exists").Wrap(err)
+		case 1451:
+			return NewConflict("referenced", "record is still referenced").Wrap(err)
+		case 1452:
+			return NewValidation("invalid_reference", "referenced record does not exist").Wrap(err)
+		case 3819:
+			return NewValidation("constraint_violation", "value violates a constraint").Wrap(err)
+		}
+	}
+
+	return NewInternal(err)
+}
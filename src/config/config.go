@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the application. Settings are read from
+// the defaults, then from the YAML file named by CHARTS_CONFIG, if any, and
+// finally from environment variables, each overriding the previous.
+type Config struct {
+	Listen    string   `yaml:"listen"`
+	BatchSize int      `yaml:"batch_size"`
+	Database  Database `yaml:"database"`
+	Redis     Redis    `yaml:"redis"`
+	Cache     Cache    `yaml:"cache"`
+	CORS      CORS     `yaml:"cors"`
+	Notify    Notify   `yaml:"notify"`
+	Metrics   Metrics  `yaml:"metrics"`
+	// ShutdownTimeout bounds how long in-flight requests and background
+	// workers may take to finish after SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Database struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type Cache struct {
+	ChartTTL time.Duration `yaml:"chart_ttl"`
+}
+
+type CORS struct {
+	Origins []string `yaml:"origins"`
+}
+
+type Notify struct {
+	SMTPAddr     string `yaml:"smtp_addr"`
+	SMTPFrom     string `yaml:"smtp_from"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	WebhookURL   string `yaml:"webhook_url"`
+}
+
+// Metrics protects /metrics: scrapers send the token as a bearer token.
+// Without a token the endpoint is not served.
+type Metrics struct {
+	Token string `yaml:"token"`
+}
+
+func Default() *Config {
+	return &Config{
+		Listen:    ":1323",
+		BatchSize: 1000,
+		Database: Database{
+			Host:     "sql_charts",
+			Port:     3306,
+			User:     "root",
+			Password: "secret",
+			Name:     "charts",
+		},
+		Redis: Redis{
+			Addr: "redis:6379",
+		},
+		Cache: Cache{
+			ChartTTL: 10 * time.Minute,
+		},
+		CORS: CORS{
+			Origins: []string{"*"},
+		},
+		ShutdownTimeout: 15 * time.Second,
+	}
+}
+
+// Load reads and validates the configuration.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CHARTS_CONFIG"); path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.readEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) readFile(path string) error {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config: %s: only YAML files are supported", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) readEnv() error {
+	texts := map[string]*string{
+		"LISTEN_ADDR":          &cfg.Listen,
+		"MYSQL_HOST":           &cfg.Database.Host,
+		"MYSQL_USER":           &cfg.Database.User,
+		"MYSQL_PASSWORD":       &cfg.Database.Password,
+		"MYSQL_DATABASE":       &cfg.Database.Name,
+		"REDIS_ADDR":           &cfg.Redis.Addr,
+		"REDIS_PASSWORD":       &cfg.Redis.Password,
+		"NOTIFY_SMTP_ADDR":     &cfg.Notify.SMTPAddr,
+		"NOTIFY_SMTP_FROM":     &cfg.Notify.SMTPFrom,
+		"NOTIFY_SMTP_USERNAME": &cfg.Notify.SMTPUsername,
+		"NOTIFY_SMTP_PASSWORD": &cfg.Notify.SMTPPassword,
+		"NOTIFY_WEBHOOK_URL":   &cfg.Notify.WebhookURL,
+		"METRICS_TOKEN":        &cfg.Metrics.Token,
+	}
+	for name, target := range texts {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+
+	ints := map[string]*int{
+		"BATCH_SIZE": &cfg.BatchSize,
+		"MYSQL_PORT": &cfg.Database.Port,
+		"REDIS_DB":   &cfg.Redis.DB,
+	}
+	for name, target := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("config: %s must be an integer", name)
+			}
+			*target = number
+		}
+	}
+
+	if value, ok := os.LookupEnv("CACHE_CHART_TTL"); ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("config: CACHE_CHART_TTL must be a duration such as 10m")
+		}
+		cfg.Cache.ChartTTL = ttl
+	}
+	if value, ok := os.LookupEnv("SHUTDOWN_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("config: SHUTDOWN_TIMEOUT must be a duration such as 15s")
+		}
+		cfg.ShutdownTimeout = timeout
+	}
+	if value, ok := os.LookupEnv("CORS_ORIGINS"); ok {
+		cfg.CORS.Origins = splitList(value)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate reports every invalid setting at once.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	_, _, err := net.SplitHostPort(cfg.Listen)
+	check(err == nil, "listen must be an address such as :1323")
+	check(cfg.BatchSize >= 1 && cfg.BatchSize <= 10000, "batch_size must be between 1 and 10000")
+	check(cfg.Database.Host != "", "database.host is required")
+	check(cfg.Database.Port >= 1 && cfg.Database.Port <= 65535, "database.port must be between 1 and 65535")
+	check(cfg.Database.User != "", "database.user is required")
+	check(cfg.Database.Name != "", "database.name is required")
+	check(cfg.Redis.Addr != "", "redis.addr is required")
+	check(cfg.Redis.DB >= 0, "redis.db must not be negative")
+	check(cfg.Cache.ChartTTL > 0, "cache.chart_ttl must be positive")
+	check(cfg.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	check(len(cfg.CORS.Origins) > 0, "cors.origins must not be empty")
+	check(cfg.Notify.SMTPAddr == "" || cfg.Notify.SMTPFrom != "", "notify.smtp_from is required with notify.smtp_addr")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// DSN returns the MySQL data source name of the database. The driver
+// formats it, so credentials may contain any character.
+func (database Database) DSN() string {
+	dsn := mysql.NewConfig()
+	dsn.User = database.User
+	dsn.Passwd = database.Password
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(database.Host, strconv.Itoa(database.Port))
+	dsn.DBName = database.Name
+	dsn.ParseTime = true
+	dsn.Loc = time.Local
+	return dsn.FormatDSN()
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/issue"
+	"charts/domain/project"
+	"charts/domain/user"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"slices"
+	"strconv"
+)
+
+func forbidden() error {
+	return apperr.NewForbidden("forbidden", "not allowed for this user")
+}
+
+func requireAdmin(actor *user.User) error {
+	if actor == nil || !actor.Admin {
+		return forbidden()
+	}
+	return nil
+}
+
+// Authorize fails unless the actor is a global admin or holds at least the
+// given role in the project.
+func (controller *Controller) Authorize(actor *user.User, projectID uint, role string) error {
+	if actor == nil {
+		return forbidden()
+	}
+	if actor.Admin {
+		return nil
+	}
+
+	member, err := controller.Repo.GetMember(projectID, actor.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return forbidden()
+	}
+	if err != nil {
+		return err
+	}
+	if !member.Allows(role) {
+		return forbidden()
+	}
+	return nil
+}
+
+// Allowed is Authorize for checks that filter rather than fail: it reports
+// a forbidden actor as false instead of as an error.
+func (controller *Controller) Allowed(actor *user.User, projectID uint, role string) (bool, error) {
+	err := controller.Authorize(actor, projectID, role)
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) && appErr.Kind == apperr.Forbidden {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (controller *Controller) authorizeIssues(actor *user.User, issues []issue.Issue, role string) error {
+	checked := map[uint]bool{}
+	for _, item := range issues {
+		if checked[item.ProjectID] {
+			continue
+		}
+		if err := controller.Authorize(actor, item.ProjectID, role); err != nil {
+			return err
+		}
+		checked[item.ProjectID] = true
+	}
+	return nil
+}
+
+// ScopeProjects limits a project_id filter to the projects the actor can
+// view. A nil result means no restriction. Asking for a project outside of
+// the actor's scope is an error.
+func (controller *Controller) ScopeProjects(actor *user.User, requested []string) ([]string, error) {
+	if actor == nil {
+		return nil, forbidden()
+	}
+	if actor.Admin {
+		return requested, nil
+	}
+
+	ids, err := controller.Repo.MemberProjectIDs(actor.ID, project.RolesAtLeast(project.RoleViewer))
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]string, 0, len(ids))
+	for _, id := range ids {
+		visible = append(visible, strconv.FormatUint(uint64(id), 10))
+	}
+
+	if len(requested) == 0 {
+		if len(visible) == 0 {
+			return []string{"0"}, nil
+		}
+		return visible, nil
+	}
+	for _, id := range requested {
+		if !slices.Contains(visible, id) {
+			return nil, forbidden()
+		}
+	}
+	return requested, nil
+}
+
+func (controller *Controller) ListMembers(actor *user.User, projectID uint) ([]*project.Member, error) {
+	if err := controller.Authorize(actor, projectID, project.RoleViewer); err != nil {
+		return nil, err
+	}
+	return controller.Repo.ListMembers(projectID)
+}
+
+// SaveMember adds the user to the project or changes their role.
+func (controller *Controller) SaveMember(actor *user.User, projectID uint, dto project.DTOMember) (*project.Member, error) {
+	if err := controller.Authorize(actor, projectID, project.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	errs := dto.Validate()
+	if _, err := controller.Repo.GetProject(projectID); err != nil {
+		return nil, apperr.From(err, "project not found")
+	}
+	if dto.UserID != 0 {
+		if _, err := controller.Repo.GetUser(dto.UserID); errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("user_id", "user does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	member := controller.Domain.CreateMember(projectID, dto.UserID, dto.Role)
+	if err := controller.Repo.SaveMember(member); err != nil {
+		return nil, err
+	}
+	return controller.Repo.GetMember(projectID, dto.UserID)
+}
+
+func (controller *Controller) RemoveMember(actor *user.User, projectID uint, userID uint) error {
+	if err := controller.Authorize(actor, projectID, project.RoleAdmin); err != nil {
+		return err
+	}
+	return controller.Repo.DeleteMember(projectID, userID)
+}
+
+// PromoteAdmin makes an existing user a global admin. It is meant for the
+// command line, to recover access to an installation without admins; see
+// SetPassword for users that have no password yet.
+func (controller *Controller) PromoteAdmin(email string) error {
+	found, err := controller.Repo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	return controller.Repo.SetAdmin(found.ID, true)
+}
+
+// SetPassword replaces the password of a user and revokes their tokens.
+// It is meant for the command line: users that existed before passwords
+// were introduced have none and cannot log in until one is set.
+func (controller *Controller) SetPassword(email string, password string) error {
+	if err := user.ValidatePassword(password).Err(); err != nil {
+		return err
+	}
+	found, err := controller.Repo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return controller.Repo.SetPassword(found.ID, string(hash))
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/user"
+	"charts/domain/validation"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"time"
+)
+
+const TokenTTL = 7 * 24 * time.Hour
+
+func badCredentials() error {
+	return apperr.NewUnauthorized("invalid_credentials", "invalid email or password")
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Login checks the credentials and issues a new bearer token. Only the hash
+// of the token is stored.
+func (controller *Controller) Login(email string, password string) (string, time.Time, error) {
+	found, err := controller.Repo.GetUserByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", time.Time{}, badCredentials()
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if found.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(found.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, badCredentials()
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(secret)
+	expiresAt := time.Now().Add(TokenTTL)
+
+	err = controller.Repo.CreateToken(controller.Domain.CreateToken(found.ID, hashToken(token), expiresAt))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+func (controller *Controller) Authenticate(token string) (*user.User, error) {
+	found, err := controller.Repo.FindToken(hashToken(token))
+	// The preload skips deleted users and leaves the zero user behind.
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && found.User.ID == 0 {
+		return nil, apperr.NewUnauthorized("invalid_token", "invalid or expired token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found.User, nil
+}
+
+func (controller *Controller) Logout(token string) error {
+	return controller.Repo.DeleteToken(hashToken(token))
+}
+
+func (controller *Controller) newUser(dto user.DTONewUser) (*user.User, validation.Errors, error) {
+	errs := dto.Validate()
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	var passwordHash string
+	if dto.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(dto.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		passwordHash = string(hash)
+	}
+
+	return controller.Domain.CreateUser(dto.Email, passwordHash), nil, nil
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"charts/helpers"
+	"charts/infra"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ChartCacheKey returns the Redis key of a chart result. The key includes
+// the resolved dates of a line chart, which move with the clock when the
+// request leaves them out, and the versions of the cache tags the chart
+// depends on: the projects in scope, or all issues for an unrestricted
+// scope, and the user and project fields of bar charts.
+func (controller *Controller) ChartCacheKey(ctx context.Context, request interface{}, dates []time.Time, scope []string) (string, error) {
+	tags := []string{infra.FieldsTag}
+	if scope == nil {
+		tags = append(tags, infra.IssuesTag)
+	}
+	for _, id := range scope {
+		tags = append(tags, infra.ProjectTag(id))
+	}
+
+	versions, err := controller.Redis.Versions(ctx, tags)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"request":  request,
+		"dates":    dates,
+		"scope":    scope,
+		"versions": versions,
+	})
+	if err != nil {
+		return "", err
+	}
+	return "chart:" + helpers.GenerateCacheKey(data), nil
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/comment"
+	"charts/domain/project"
+	"charts/domain/user"
+	"errors"
+	"gorm.io/gorm"
+	"sort"
+)
+
+func (controller *Controller) ListComments(actor *user.User, issueID uint) ([]comment.DTOView, error) {
+	if _, err := controller.GetIssue(actor, issueID, project.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	items, err := controller.Repo.ListComments(issueID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]comment.DTOView, 0, len(items))
+	for _, item := range items {
+		views = append(views, comment.View(item))
+	}
+	return views, nil
+}
+
+// AddComment posts a comment on the issue, or a reply when the payload
+// names a parent comment of the same issue.
+func (controller *Controller) AddComment(actor *user.User, issueID uint, dto comment.DTOComment) (*comment.DTOView, error) {
+	found, err := controller.GetIssue(actor, issueID, project.RoleReporter)
+	if err != nil {
+		return nil, err
+	}
+	if err := controller.EnsureEditable(found); err != nil {
+		return nil, err
+	}
+
+	errs := dto.Validate()
+	if dto.ParentID != nil && *dto.ParentID != 0 {
+		if _, err := controller.Repo.GetComment(issueID, *dto.ParentID); errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("parent_id", "comment does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	item := controller.Domain.CreateComment(issueID, dto.ParentID, actor, dto.Body)
+	if err := controller.Repo.CreateComment(item); err != nil {
+		return nil, err
+	}
+	item.Author = *actor
+
+	view := comment.View(item)
+	return &view, nil
+}
+
+// EditComment replaces the body of a comment. Only its author may edit it.
+func (controller *Controller) EditComment(actor *user.User, issueID uint, id uint, dto comment.DTOComment) (*comment.DTOView, error) {
+	found, err := controller.GetIssue(actor, issueID, project.RoleReporter)
+	if err != nil {
+		return nil, err
+	}
+	if err := controller.EnsureEditable(found); err != nil {
+		return nil, err
+	}
+
+	item, err := controller.Repo.GetComment(issueID, id)
+	if err != nil {
+		return nil, apperr.From(err, "comment not found")
+	}
+	if item.AuthorID != actor.ID {
+		return nil, forbidden()
+	}
+
+	// A comment cannot move to another thread.
+	dto.ParentID = nil
+	if err := dto.Validate().Err(); err != nil {
+		return nil, err
+	}
+
+	if err := controller.Repo.UpdateComment(item.ID, dto.Body); err != nil {
+		return nil, err
+	}
+	item, err = controller.Repo.GetComment(issueID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	view := comment.View(item)
+	return &view, nil
+}
+
+// DeleteComment removes a comment. Its author and project maintainers may
+// delete it; replies stay in the thread.
+func (controller *Controller) DeleteComment(actor *user.User, issueID uint, id uint) error {
+	found, err := controller.GetIssue(actor, issueID, project.RoleViewer)
+	if err != nil {
+		return err
+	}
+
+	item, err := controller.Repo.GetComment(issueID, id)
+	if err != nil {
+		return apperr.From(err, "comment not found")
+	}
+	if item.AuthorID != actor.ID {
+		if err := controller.Authorize(actor, found.ProjectID, project.RoleMaintainer); err != nil {
+			return err
+		}
+	}
+	return controller.Repo.DeleteComment(item.ID)
+}
+
+// IssueTimeline merges the field changes and the comments of the issue in
+// chronological order.
+func (controller *Controller) IssueTimeline(actor *user.User, issueID uint) ([]comment.DTOTimelineEntry, error) {
+	history, err := controller.IssueHistory(actor, issueID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := controller.Repo.ListComments(issueID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := make([]comment.DTOTimelineEntry, 0, len(history)+len(comments))
+	for _, item := range history {
+		timeline = append(timeline, comment.DTOTimelineEntry{
+			Type:      "change",
+			ID:        item.ID,
+			CreatedAt: item.CreatedAt,
+			Actor:     item.Actor,
+			Changes:   item.Changes,
+		})
+	}
+	for _, item := range comments {
+		view := comment.View(item)
+		timeline = append(timeline, comment.DTOTimelineEntry{
+			Type:      "comment",
+			ID:        item.ID,
+			CreatedAt: item.CreatedAt,
+			Actor:     view.Author,
+			Comment:   &view,
+		})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].CreatedAt.Before(timeline[j].CreatedAt)
+	})
+	return timeline, nil
+}
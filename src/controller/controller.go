@@ -1,17 +1,23 @@
 package controller
 
 import (
+	"charts/apperr"
 	"charts/domain"
+	"charts/domain/diff"
 	"charts/domain/issue"
 	"charts/domain/project"
+	"charts/domain/snapshot"
 	"charts/domain/user"
+	"charts/domain/validation"
+	"charts/domain/workflow"
 	"charts/helpers"
 	"charts/infra"
+	"charts/migrations"
 	"encoding/json"
 	"errors"
-	_ "errors"
-	"gorm.io/gorm"
 	_ "gorm.io/gorm"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -19,6 +25,11 @@ type Controller struct {
 	Repo *infra.Repository
 	Domain *domain.Domain
 	Redis *infra.RedisRepository
+	Workflow *workflow.Workflow
+	// Notifiers are the configured notification channels by name.
+	Notifiers map[string]infra.Notifier
+	Migrator *migrations.Migrator
+	Workers *infra.Workers
 }
 
 type LinePoint struct {
@@ -26,181 +37,547 @@ type LinePoint struct {
 	 Data []int
 }
 
-func (controller *Controller) CreateIssue(title string, user user.User, project project.Project, priority int, status string, deadline time.Time, watchers []user.User) (id uint, err error) {
-	newIssue := controller.Domain.CreateIssue(title, user, project, priority, status, deadline, watchers)
-	id, err = controller.Repo.CreateIssue(newIssue)
+func (controller *Controller) CreateIssue(actor *user.User, dto issue.DTOissue) (id uint, err error) {
+	issues, err := controller.ValidateIssues([]issue.DTOissue{dto}, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := controller.authorizeIssues(actor, issues, project.RoleReporter); err != nil {
+		return 0, err
+	}
+	id, err = controller.Repo.CreateIssue(&issues[0])
 	return
 }
 
-func (controller *Controller) CreateIssues(issues []issue.Issue) error {
-	err := controller.Repo.CreateIssues(issues)
+// CreateIssues stores all issues or none of them. Access is checked for the
+// whole slice first; the inserts are split into batches of batchSize rows
+// within one transaction.
+func (controller *Controller) CreateIssues(actor *user.User, issues []issue.Issue, batchSize int) error {
+	if err := controller.authorizeIssues(actor, issues, project.RoleReporter); err != nil {
+		return err
+	}
+	err := controller.Repo.CreateIssues(issues, batchSize)
 	return err
 }
 
-func (controller *Controller) CreateProject(name string, blocked ...bool) (id uint, err error) {
+// CreateProject stores the project and makes its creator the project admin.
+func (controller *Controller) CreateProject(actor *user.User, name string, blocked ...bool) (id uint, err error) {
 	blockedValue := false
 	if len(blocked) > 0 {
 		blockedValue = blocked[0]
 	}
 	newProject := controller.Domain.CreateProject(name, blockedValue)
-	id, err = controller.Repo.CreateProject(newProject)
+	if err := newProject.Validate().Err(); err != nil {
+		return 0, err
+	}
+	err = controller.Repo.Transaction(func(tx *infra.Repository) error {
+		if id, err = tx.CreateProject(newProject); err != nil {
+			return err
+		}
+		return tx.SaveMember(controller.Domain.CreateMember(id, actor.ID, project.RoleAdmin))
+	})
 	return
 }
 
-func (controller *Controller) CreateProjects(projects []project.Project) error {
-	err := controller.Repo.CreateProjects(projects)
-	return err
+func (controller *Controller) CreateProjects(actor *user.User, projects []project.Project) error {
+	if err := validateProjects(projects); err != nil {
+		return err
+	}
+	return controller.Repo.Transaction(func(tx *infra.Repository) error {
+		if err := tx.CreateProjects(projects); err != nil {
+			return err
+		}
+		for _, item := range projects {
+			if err := tx.SaveMember(controller.Domain.CreateMember(item.ID, actor.ID, project.RoleAdmin)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (controller *Controller) CreateUser(email string) (id uint, err error) {
-	newUser := controller.Domain.CreateUser(email)
+// CreateUser registers a user. Only global admins may do so, except for the
+// very first user, who is created without a token, needs a password and
+// becomes the global admin.
+func (controller *Controller) CreateUser(actor *user.User, dto user.DTONewUser) (id uint, err error) {
+	if actor == nil {
+		return controller.createFirstUser(dto)
+	}
+	if err := requireAdmin(actor); err != nil {
+		return 0, err
+	}
+
+	newUser, errs, err := controller.newUser(dto)
+	if err != nil {
+		return 0, err
+	}
+	if err := errs.Err(); err != nil {
+		return 0, err
+	}
+	if err := controller.checkEmails([]string{dto.Email}); err != nil {
+		return 0, err
+	}
 	id, err = controller.Repo.CreateUser(newUser)
 	return
 }
 
-func (controller *Controller) CreateUsers(users []user.User) error {
+func (controller *Controller) createFirstUser(dto user.DTONewUser) (uint, error) {
+	newUser, errs, err := controller.newUser(dto)
+	if err != nil {
+		return 0, err
+	}
+	if dto.Password == "" {
+		errs.Add("password", "is required for the first user")
+	}
+	if err := errs.Err(); err != nil {
+		return 0, err
+	}
+	newUser.Admin = true
+
+	id, err := controller.Repo.CreateFirstUser(newUser)
+	if errors.Is(err, infra.ErrBootstrapClosed) {
+		return 0, apperr.NewUnauthorized("missing_token", "authentication required")
+	}
+	return id, err
+}
+
+func (controller *Controller) CreateUsers(actor *user.User, dtos []user.DTONewUser) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
+
+	var errs validation.Errors
+	var emails []string
+	seen := map[string]bool{}
+	users := make([]user.User, 0, len(dtos))
+	for i, dto := range dtos {
+		newUser, itemErrs, err := controller.newUser(dto)
+		if err != nil {
+			return err
+		}
+		if seen[dto.Email] {
+			itemErrs.Add("email", "is repeated in the batch")
+		}
+		seen[dto.Email] = true
+		errs.Merge(i, itemErrs)
+		if newUser != nil {
+			users = append(users, *newUser)
+		}
+		emails = append(emails, dto.Email)
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+	if err := controller.checkEmails(emails); err != nil {
+		return err
+	}
+
 	err := controller.Repo.CreateUsers(users)
 	return err
 }
 
-func (controller *Controller) CreateDiff(issueID uint, jsonBody map[string]interface{}, oldIssue *issue.Issue) (id uint, err error) {
-
-	comment, err := json.Marshal(jsonBody)
+func (controller *Controller) checkEmails(emails []string) error {
+	taken, err := controller.Repo.TakenEmails(emails)
 	if err != nil {
-	    return 0, err
+		return err
 	}
+	if len(taken) > 0 {
+		return apperr.NewConflict("email_taken", "email is already registered: "+strings.Join(taken, ", "))
+	}
+	return nil
+}
 
-	newIssue, err := controller.Repo.GetIssue(oldIssue.ID)
-		if err != nil {
-			return 0, err
-		}
+// UpdateIssue applies the patch to the issue and records the old and new
+// value of every patched field in its history. A non-zero version must match
+// the stored one; the write itself fails if the issue changes concurrently.
+// It returns the diff ID and the new issue version.
+func (controller *Controller) UpdateIssue(actor *user.User, id uint, version uint, dto issue.DTOPatch) (uint, uint, error) {
+	oldIssue, err := controller.GetIssue(actor, id, project.RoleReporter)
+	if err != nil {
+		return 0, 0, err
+	}
+	if version != 0 && version != oldIssue.Version {
+		return 0, 0, versionConflict()
+	}
+	if err := controller.EnsureEditable(oldIssue); err != nil {
+		return 0, 0, err
+	}
 
-	newJson := map[string]interface{}{}
-	if _, ok := jsonBody["title"].(string); ok {
-		oldNewTitle := map[string]interface{}{
-	        "old": oldIssue.Title,
-	        "new": newIssue.Title,
-    	}
-    	newJson["title"] = oldNewTitle
+	watchers, err := controller.ValidatePatch(actor, dto)
+	if err != nil {
+		return 0, 0, err
 	}
-	if _, ok := jsonBody["priority"].(float64); ok {
-		oldNewPriority := map[string]interface{}{
-	        "old": oldIssue.Priority,
-	        "new": newIssue.Priority,
-	    }
-	    newJson["priority"] = oldNewPriority
+
+	updatedIssue := *oldIssue
+	dto.Apply(&updatedIssue, watchers)
+	if err := controller.checkTransition(actor, oldIssue, &updatedIssue); err != nil {
+		return 0, 0, err
 	}
-	if _, ok := jsonBody["status"].(string); ok {
-		oldNewStatus := map[string]interface{}{
-	        "old": oldIssue.Status,
-	        "new": newIssue.Status,
-	    }
-	    newJson["status"] = oldNewStatus
+
+	newDiff, err := controller.newDiff(actor, dto, oldIssue, &updatedIssue)
+	if err != nil {
+		return 0, 0, err
 	}
-	if _, ok := jsonBody["watchers"]; ok {
-		var oldWatchers []uint
-		var newWatchers []uint
 
-		for _,watcher := range oldIssue.Watchers {
-			oldWatchers = append(oldWatchers, watcher.ID)
+	err = controller.Repo.Transaction(func(tx *infra.Repository) error {
+		if err := tx.UpdateIssue(&updatedIssue, dto.Watchers != nil, newDiff); err != nil {
+			return err
 		}
-		for _,watcher := range newIssue.Watchers {
-			newWatchers = append(newWatchers, watcher.ID)
+		if oldIssue.Status == updatedIssue.Status {
+			return nil
 		}
+		return controller.Workflow.Fire(tx, workflow.Change{
+			IssueID:   updatedIssue.ID,
+			ProjectID: updatedIssue.ProjectID,
+			From:      oldIssue.Status,
+			To:        updatedIssue.Status,
+			Actor:     actor,
+		})
+	})
+	if errors.Is(err, infra.ErrStaleIssue) {
+		return 0, 0, versionConflict()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
 
-		oldNewWatchers := map[string]interface{}{
-	        "old": oldWatchers,
-	        "new": newWatchers,
-	    }
-	    newJson["watchers"] = oldNewWatchers
+	return newDiff.ID, updatedIssue.Version, nil
+}
+
+func versionConflict() error {
+	return apperr.NewConflict("version_conflict", "issue was modified by someone else, reload it and retry")
+}
+
+func (controller *Controller) newDiff(actor *user.User, dto issue.DTOPatch, oldIssue *issue.Issue, updatedIssue *issue.Issue) (*diff.CommentsDiff, error) {
+	comment, err := json.Marshal(dto)
+	if err != nil {
+		return nil, err
 	}
 
-	resultComment, err := json.Marshal(newJson)
+	resultComment, err := json.Marshal(dto.Changes(oldIssue, updatedIssue))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	newComment := controller.Domain.CreateDiff(comment, issueID, resultComment)
-	id, err = controller.Repo.CreateDiff(newComment)
-	return
+	return controller.Domain.CreateDiff(comment, oldIssue.ID, resultComment, actor), nil
 }
 
-func (controller *Controller) DeleteIssue(id uint) error {
-	err := controller.Repo.DeleteIssue(id)
-	return err
+func (controller *Controller) GetIssue(actor *user.User, issueID uint, role string) (*issue.Issue, error) {
+	found, err := controller.Repo.GetIssue(issueID)
+	if err != nil {
+		return nil, apperr.From(err, "issue not found")
+	}
+	if err := controller.Authorize(actor, found.ProjectID, role); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (controller *Controller) IssueHistory(actor *user.User, issueID uint) ([]diff.DTOHistory, error) {
+	if _, err := controller.GetIssue(actor, issueID, project.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	diffs, err := controller.Repo.ListDiffs(issueID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]diff.DTOHistory, 0, len(diffs))
+	for _, item := range diffs {
+		entry := diff.DTOHistory{
+			ID:        item.ID,
+			CreatedAt: item.CreatedAt,
+			Changes:   item.Result,
+		}
+		if item.Actor != nil {
+			entry.Actor = &user.DTOUser{ID: item.Actor.ID, Email: item.Actor.Email}
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// DeleteIssue removes the issue and records who deleted it in its history.
+func (controller *Controller) DeleteIssue(actor *user.User, id uint) error {
+	found, err := controller.GetIssue(actor, id, project.RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := json.Marshal(map[string]interface{}{
+		"deleted": map[string]interface{}{"old": false, "new": true},
+	})
+	if err != nil {
+		return err
+	}
+
+	return controller.Repo.DeleteIssue(found, controller.Domain.CreateDiff([]byte("{}"), id, deleted, actor))
 }
 
-func (controller *Controller) DeleteProject(id uint) error {
+func (controller *Controller) DeleteProject(actor *user.User, id uint) error {
+	if err := controller.Authorize(actor, id, project.RoleAdmin); err != nil {
+		return err
+	}
 	err := controller.Repo.DeleteProject(id)
 	return err
 }
 
-func (controller *Controller) DeleteUser(id uint) error {
+func (controller *Controller) DeleteUser(actor *user.User, id uint) error {
+	if err := requireAdmin(actor); err != nil {
+		return err
+	}
 	err := controller.Repo.DeleteUser(id)
 	return err
 }
 
-func (controller *Controller) LineIssues() (map[time.Time]map[string]int, error) {
-	var reason string
+func (controller *Controller) LineIssues(dates []time.Time, groupBy string, filters map[string][]string) (map[time.Time]map[string]int, error) {
+	scope := map[string]interface{}{}
+	if projectIDs, ok := filters["project_id"]; ok {
+		scope["project_id"] = projectIDs
+	}
+	custom, err := controller.Repo.CustomStatuses(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every status of the workflow gets a point, also when no issue has it.
+	var statuses []string
+	if groupBy == "" || groupBy == "status" {
+		for _, status := range controller.Workflow.Statuses(custom) {
+			if values, ok := filters["status"]; !ok || slices.Contains(values, status) {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+
 	points := map[time.Time]map[string]int{}
-	statuses := []string{"open", "closed", "in_progress", "canceled"}
-	today := time.Now()
-	dates := make([]time.Time, 10)
+	for _, date := range dates {
+		points[date] = make(map[string]int)
+		for _, status := range statuses {
+			points[date][status] = 0
+		}
+	}
 
-	for i := 0; i < 10; i++ {
-		dates[i] = today.AddDate(0, 0, i-9)
+	// A point at midnight is the end of the previous day, which can be read
+	// from the daily snapshots once that day has been recorded.
+	now := time.Now()
+	snapshotPoints := map[string]time.Time{}
+	var days []time.Time
+	for _, date := range dates {
+		if date.Before(now) && date.Equal(helpers.StartOfDay(date)) {
+			day := date.AddDate(0, 0, -1)
+			snapshotPoints[helpers.DayKey(day)] = date
+			days = append(days, day)
+		}
 	}
 
-	ids, err := controller.Repo.ListIssueID()
+	complete, err := controller.Repo.CompleteSnapshotDays(days)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, date := range dates[:9] {
-		for _, id := range ids {
-			diffBefore, err := controller.Repo.DiffBefore(id, date)
-			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound)  {
-				return nil, err
-			}
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				diffAfter, err := controller.Repo.DiffAfter(id, date)
-				if err != nil && !errors.Is(err, gorm.ErrRecordNotFound)  {
-					return nil, err
-				}
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					reason, err = controller.Repo.FindIssueStatus(id)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					reason, err = helpers.FindStatus(diffAfter, "old")
-					if err != nil {
-						return nil, err
-					}
-				}
-			} else {
-				reason, err = helpers.FindStatus(diffBefore, "new")
-				if err != nil {
-					return nil, err
-				}
-			}
-			if _, exists := points[date]; !exists {
-				points[date] = make(map[string]int)
-			}
-			points[date][reason] += 1
+	var snapshotDays []time.Time
+	for _, day := range days {
+		if complete[helpers.DayKey(day)] {
+			snapshotDays = append(snapshotDays, day)
+		} else {
+			delete(snapshotPoints, helpers.DayKey(day))
 		}
 	}
 
-	if _, exists := points[dates[9]]; !exists {
-		points[dates[9]] = make(map[string]int)
+	var historyDates []time.Time
+	for _, date := range dates {
+		if _, ok := snapshotPoints[helpers.DayKey(date.AddDate(0, 0, -1))]; !ok || !date.Equal(helpers.StartOfDay(date)) {
+			historyDates = append(historyDates, date)
+		}
+	}
+
+	if len(snapshotDays) > 0 {
+		snapshotFilters := map[string]interface{}{}
+		for column, values := range filters {
+			snapshotFilters[column] = values
+		}
+
+		counts, err := controller.Repo.CountSnapshots(snapshotDays, groupBy, snapshotFilters)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range counts {
+			points[snapshotPoints[helpers.DayKey(item.Day)]][item.Reason] = item.Count
+		}
 	}
-	for _, status := range statuses {
-		currentCountIssues, err := controller.Repo.CountIssuesLine(status)
+
+	if len(historyDates) > 0 {
+		err = controller.replayHistory(historyDates, groupBy, filters, func(group infra.IssueGroup, point statusPoint) error {
+			if groupBy == "" || groupBy == "status" {
+				points[point.date][point.status] += 1
+			} else {
+				points[point.date][group.Reason] += 1
+			}
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		points[dates[9]][status] = currentCountIssues
 	}
 
 	return points, nil
 }
+
+// BackfillSnapshots rebuilds the daily snapshots of every finished day from
+// the stored diff history, replacing the stored ones.
+func (controller *Controller) BackfillSnapshots() (int, error) {
+	first, err := controller.Repo.FirstIssueDate()
+	if err != nil || first.IsZero() {
+		return 0, err
+	}
+
+	var ends []time.Time
+	var days []time.Time
+	today := helpers.StartOfDay(time.Now())
+	for day := helpers.StartOfDay(first); day.Before(today); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+		ends = append(ends, day.AddDate(0, 0, 1))
+	}
+	if len(days) == 0 {
+		return 0, nil
+	}
+
+	if err := controller.Repo.DeleteSnapshots(days); err != nil {
+		return 0, err
+	}
+	var snapshots []snapshot.IssueDailySnapshot
+	err = controller.replayHistory(ends, "", nil, func(group infra.IssueGroup, point statusPoint) error {
+		snapshots = append(snapshots, snapshot.IssueDailySnapshot{
+			Day:       point.date.AddDate(0, 0, -1),
+			IssueID:   uint(group.ID),
+			Status:    point.status,
+			UserID:    group.UserID,
+			ProjectID: group.ProjectID,
+			Priority:  group.Priority,
+		})
+		if len(snapshots) < infra.SnapshotBatchSize {
+			return nil
+		}
+		err := controller.Repo.SaveSnapshots(snapshots)
+		snapshots = snapshots[:0]
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := controller.Repo.SaveSnapshots(snapshots); err != nil {
+		return 0, err
+	}
+
+	return len(days), controller.Repo.MarkSnapshotDays(days)
+}
+
+// replayHistory streams the status changes of the filtered issues and calls
+// fn with the status of each issue at every date it existed.
+func (controller *Controller) replayHistory(dates []time.Time, groupBy string, filters map[string][]string, fn func(group infra.IssueGroup, point statusPoint) error) error {
+	issueFilters := map[string]interface{}{}
+	for column, values := range filters {
+		if column != "status" {
+			issueFilters[column] = values
+		}
+	}
+	statuses, byStatus := filters["status"]
+
+	groups, err := controller.Repo.ListIssueGroup(groupBy, issueFilters)
+	if err != nil {
+		return err
+	}
+	issues := make(map[int]infra.IssueGroup, len(groups))
+	for _, group := range groups {
+		issues[group.ID] = group
+	}
+
+	count := func(group infra.IssueGroup, changes []infra.StatusChange) error {
+		for _, point := range statusTimeline(group, changes, dates) {
+			if byStatus && !slices.Contains(statuses, point.status) {
+				continue
+			}
+			if err := fn(group, point); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var changes []infra.StatusChange
+	flush := func() error {
+		if len(changes) == 0 {
+			return nil
+		}
+		var err error
+		if group, ok := issues[changes[0].IssueID]; ok {
+			delete(issues, group.ID)
+			err = count(group, changes)
+		}
+		changes = changes[:0]
+		return err
+	}
+
+	err = controller.Repo.StatusHistory(issueFilters, func(change infra.StatusChange) error {
+		if len(changes) > 0 && changes[0].IssueID != change.IssueID {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, group := range issues {
+		if err := count(group, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type statusPoint struct {
+	date   time.Time
+	status string
+}
+
+// statusTimeline replays the ordered status changes of a single issue and
+// returns its status at every date from its creation until its deletion.
+// Dates that are not in the past take the current status.
+func statusTimeline(group infra.IssueGroup, changes []infra.StatusChange, dates []time.Time) []statusPoint {
+	points := make([]statusPoint, 0, len(dates))
+	now := time.Now()
+	next := 0
+
+	for _, date := range dates {
+		if date.Before(group.CreatedAt) || group.DeletedAt != nil && !date.Before(*group.DeletedAt) {
+			continue
+		}
+
+		status := group.Status
+		if date.Before(now) {
+			for next < len(changes) && !changes[next].CreatedAt.After(date) {
+				next++
+			}
+			switch {
+			case next > 0:
+				status = changes[next-1].New
+			case len(changes) > 0:
+				status = changes[0].Old
+			}
+		}
+		points = append(points, statusPoint{date: date, status: status})
+	}
+
+	return points
+}
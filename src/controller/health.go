@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// HealthTimeout bounds the dependency checks of a readiness report.
+const HealthTimeout = 2 * time.Second
+
+// Check is the public result of one dependency check. The cause of a
+// failure is only logged, since it names hosts and ports.
+type Check struct {
+	OK bool `json:"ok"`
+}
+
+type MigrationCheck struct {
+	Check
+	Current int  `json:"current"`
+	Latest  int  `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+type Health struct {
+	OK         bool            `json:"ok"`
+	Database   *Check          `json:"database,omitempty"`
+	Redis      *Check          `json:"redis,omitempty"`
+	Migrations *MigrationCheck `json:"migrations,omitempty"`
+	Workers    map[string]bool `json:"workers"`
+}
+
+func check(name string, err error) *Check {
+	if err != nil {
+		log.Printf("readiness: %s: %v", name, err)
+		return &Check{}
+	}
+	return &Check{OK: true}
+}
+
+// Liveness reports whether every background worker is still running. It
+// touches no dependency, so an outage of MySQL or Redis does not get the
+// process restarted.
+func (controller *Controller) Liveness() *Health {
+	health := &Health{OK: true, Workers: controller.Workers.Running()}
+	for _, running := range health.Workers {
+		health.OK = health.OK && running
+	}
+	return health
+}
+
+// Readiness pings the database and Redis and compares the schema version
+// with the one this build expects. It fails while any of them is down or
+// migrations are pending, which the server starts with, see
+// migrations.ErrPending; worker status is reported but does not count.
+func (controller *Controller) Readiness(ctx context.Context) *Health {
+	ctx, cancel := context.WithTimeout(ctx, HealthTimeout)
+	defer cancel()
+
+	health := &Health{Workers: controller.Workers.Running()}
+
+	sqlDB, err := controller.Repo.DB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	health.Database = check("database", err)
+
+	health.Redis = check("redis", controller.Redis.Client.Ping(ctx).Err())
+
+	migrator := controller.Migrator.WithContext(ctx)
+	health.Migrations = &MigrationCheck{Latest: migrator.Latest()}
+	if health.Database.OK {
+		health.Migrations.Current, health.Migrations.Dirty, err = migrator.Current()
+		if err == nil {
+			err = migrator.Check()
+		}
+		health.Migrations.Check = *check("migrations", err)
+	}
+
+	health.OK = health.Database.OK && health.Redis.OK && health.Migrations.OK
+	return health
+}
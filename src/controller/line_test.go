@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"charts/domain/diff"
+	"charts/domain/issue"
+	"charts/domain/project"
+	"charts/domain/user"
+	"charts/domain/workflow"
+	"charts/helpers"
+	"charts/infra"
+	"charts/migrations"
+	"fmt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	benchIssues  = 50000
+	benchChanges = 4
+)
+
+var benchFlow = []string{workflow.StatusOpen, workflow.StatusInProgress, workflow.StatusClosed, workflow.StatusOpen, workflow.StatusCanceled}
+
+// benchDates returns the nine midnights LineIssues is usually asked for.
+func benchDates(now time.Time) []time.Time {
+	dates := make([]time.Time, 0, 9)
+	for day := 8; day >= 0; day-- {
+		dates = append(dates, helpers.StartOfDay(now).AddDate(0, 0, -day))
+	}
+	return dates
+}
+
+// benchHistory generates issues created within the last two weeks, each
+// with benchChanges status changes spread over its lifetime.
+func benchHistory(now time.Time) ([]infra.IssueGroup, [][]infra.StatusChange) {
+	random := rand.New(rand.NewSource(1))
+	groups := make([]infra.IssueGroup, benchIssues)
+	changes := make([][]infra.StatusChange, benchIssues)
+	for i := range groups {
+		created := now.Add(-time.Duration(random.Int63n(int64(14 * 24 * time.Hour))))
+		groups[i] = infra.IssueGroup{
+			ID:        i + 1,
+			Status:    benchFlow[benchChanges],
+			CreatedAt: created,
+		}
+		at := created
+		for step := 0; step < benchChanges; step++ {
+			at = at.Add(time.Duration(random.Int63n(int64(now.Sub(at)/2 + 1))))
+			changes[i] = append(changes[i], infra.StatusChange{
+				IssueID:   i + 1,
+				CreatedAt: at,
+				Old:       benchFlow[step],
+				New:       benchFlow[step+1],
+			})
+		}
+	}
+	return groups, changes
+}
+
+// BenchmarkLineIssuesReplay measures the status replay of LineIssues over
+// generated history, without a database.
+func BenchmarkLineIssuesReplay(b *testing.B) {
+	now := time.Now()
+	dates := benchDates(now)
+	groups, changes := benchHistory(now)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		counts := map[string]int{}
+		for i, group := range groups {
+			for _, point := range statusTimeline(group, changes[i], dates) {
+				counts[point.status]++
+			}
+		}
+	}
+}
+
+// BenchmarkLineIssues runs LineIssues against a MySQL database seeded with
+// benchIssues issues and their comments_diffs. Set CHARTS_BENCH_DSN to a
+// throwaway database; it is migrated and seeded on first use.
+func BenchmarkLineIssues(b *testing.B) {
+	dsn := os.Getenv("CHARTS_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("CHARTS_BENCH_DSN is not set")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		b.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := seedLineIssues(db, now); err != nil {
+		b.Fatal(err)
+	}
+
+	controller := &Controller{
+		Repo:     &infra.Repository{DB: db},
+		Workflow: workflow.New(),
+	}
+	dates := benchDates(now)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := controller.LineIssues(dates, "", map[string][]string{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// seedLineIssues inserts the generated history unless the database already
+// holds issues.
+func seedLineIssues(db *gorm.DB, now time.Time) error {
+	var count int64
+	if err := db.Model(&issue.Issue{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	author := &user.User{Email: "bench@example.com"}
+	if err := db.Create(author).Error; err != nil {
+		return err
+	}
+	owner := &project.Project{Name: "bench"}
+	if err := db.Create(owner).Error; err != nil {
+		return err
+	}
+
+	groups, changes := benchHistory(now)
+	issues := make([]issue.Issue, len(groups))
+	for i, group := range groups {
+		issues[i] = issue.Issue{
+			Title:     fmt.Sprintf("Issue %d", group.ID),
+			UserID:    author.ID,
+			ProjectID: owner.ID,
+			Priority:  1 + i%5,
+			Status:    group.Status,
+			Deadline:  now.AddDate(0, 1, 0),
+			Version:   1,
+		}
+		issues[i].CreatedAt = group.CreatedAt
+	}
+	if err := db.Omit(clause.Associations).CreateInBatches(issues, 1000).Error; err != nil {
+		return err
+	}
+
+	var diffs []diff.CommentsDiff
+	for i := range changes {
+		for _, change := range changes[i] {
+			result := fmt.Sprintf(`{"status":{"old":%q,"new":%q}}`, change.Old, change.New)
+			item := diff.CommentsDiff{IssueID: issues[i].ID, Diff: []byte(result), Result: []byte(result)}
+			item.CreatedAt = change.CreatedAt
+			diffs = append(diffs, item)
+		}
+	}
+	return db.Omit(clause.Associations).CreateInBatches(diffs, 1000).Error
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"charts/domain/event"
+	"charts/domain/notification"
+	"charts/domain/project"
+	"charts/infra"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// NotifyTimeout bounds one attempt to deliver a notification.
+const NotifyTimeout = 30 * time.Second
+
+// Consumers returns the outbox consumers of the application.
+func (controller *Controller) Consumers() []infra.Consumer {
+	return []infra.Consumer{
+		&infra.WebhookConsumer{Repo: controller.Repo},
+		&notifyConsumer{controller: controller},
+		&infra.CacheConsumer{Redis: controller.Redis},
+	}
+}
+
+// notifyConsumer tells the watchers and the assignee of an issue before and
+// after a change, except the actor and those who may not view the project,
+// about every issue.updated event. It only
+// queues a delivery per channel and recipient; NotificationWorker sends
+// them and retries each one on its own.
+type notifyConsumer struct {
+	controller *Controller
+}
+
+func (consumer *notifyConsumer) Name() string {
+	return "notifications"
+}
+
+func (consumer *notifyConsumer) Handle(ctx context.Context, item *event.Event) error {
+	controller := consumer.controller
+	if item.Name != event.IssueUpdated || len(controller.Notifiers) == 0 {
+		return nil
+	}
+
+	var change event.IssueChange
+	if err := json.Unmarshal(item.Payload, &change); err != nil || change.Issue == nil {
+		return err
+	}
+	var previous struct {
+		UserID *struct {
+			Old uint `json:"old"`
+		} `json:"user_id"`
+		Watchers *struct {
+			Old []uint `json:"old"`
+		} `json:"watchers"`
+	}
+	if err := json.Unmarshal(change.Diff.Result, &previous); err != nil {
+		return err
+	}
+
+	ids := []uint{change.Issue.UserID}
+	ids = append(ids, change.Issue.WatcherIDs...)
+	if previous.UserID != nil {
+		ids = append(ids, previous.UserID.Old)
+	}
+	if previous.Watchers != nil {
+		ids = append(ids, previous.Watchers.Old...)
+	}
+	users, err := controller.Repo.UsersByID(ids)
+	if err != nil {
+		return err
+	}
+
+	var recipients []string
+	for i, found := range users {
+		if change.Diff.ActorID != nil && found.ID == *change.Diff.ActorID {
+			continue
+		}
+		allowed, err := controller.Allowed(&users[i], change.Issue.ProjectID, project.RoleViewer)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			recipients = append(recipients, found.Email)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var actorEmail string
+	if change.Diff.ActorID != nil {
+		if actor, err := controller.Repo.GetUser(*change.Diff.ActorID); err == nil {
+			actorEmail = actor.Email
+		}
+	}
+
+	message, err := notification.FromDiff(change.Issue, change.Diff, actorEmail, recipients)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []notification.Delivery
+	add := func(channel string, recipient string, message *notification.Message) error {
+		payload, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, notification.Delivery{
+			EventID:       item.ID,
+			Channel:       channel,
+			Recipient:     recipient,
+			Message:       payload,
+			Status:        notification.StatusPending,
+			NextAttemptAt: time.Now(),
+		})
+		return nil
+	}
+	for channel := range controller.Notifiers {
+		if channel != notification.ChannelEmail {
+			if err := add(channel, "", message); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, recipient := range recipients {
+			single := *message
+			single.Recipients = []string{recipient}
+			if err := add(channel, recipient, &single); err != nil {
+				return err
+			}
+		}
+	}
+	return controller.Repo.EnqueueNotifications(deliveries)
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/diff"
+	"charts/domain/issue"
+	"charts/domain/project"
+	"charts/domain/user"
+	"charts/infra"
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// SetProjectBlocked blocks or unblocks the project and records the change
+// in the project history.
+func (controller *Controller) SetProjectBlocked(actor *user.User, id uint, blocked bool) (uint, error) {
+	if err := controller.Authorize(actor, id, project.RoleAdmin); err != nil {
+		return 0, err
+	}
+
+	found, err := controller.Repo.GetProject(id)
+	if err != nil {
+		return 0, apperr.From(err, "project not found")
+	}
+	if found.Blocked == blocked {
+		if blocked {
+			return 0, apperr.NewConflict("project_blocked", "project is already blocked")
+		}
+		return 0, apperr.NewConflict("project_unblocked", "project is not blocked")
+	}
+
+	result, err := json.Marshal(map[string]interface{}{
+		"blocked": map[string]interface{}{"old": found.Blocked, "new": blocked},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var diffID uint
+	err = controller.Repo.Transaction(func(tx *infra.Repository) error {
+		if err := tx.SetBlocked(id, blocked); err != nil {
+			return err
+		}
+		diffID, err = tx.CreateProjectDiff(controller.Domain.CreateProjectDiff(id, result, actor))
+		return err
+	})
+	return diffID, err
+}
+
+func (controller *Controller) ProjectHistory(actor *user.User, id uint) ([]diff.DTOHistory, error) {
+	if err := controller.Authorize(actor, id, project.RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := controller.Repo.GetProject(id); err != nil {
+		return nil, apperr.From(err, "project not found")
+	}
+
+	diffs, err := controller.Repo.ListProjectDiffs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]diff.DTOHistory, 0, len(diffs))
+	for _, item := range diffs {
+		entry := diff.DTOHistory{
+			ID:        item.ID,
+			CreatedAt: item.CreatedAt,
+			Changes:   item.Result,
+		}
+		if item.Actor != nil {
+			entry.Actor = &user.DTOUser{ID: item.Actor.ID, Email: item.Actor.Email}
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// EnsureEditable fails when the issue belongs to a blocked project.
+func (controller *Controller) EnsureEditable(item *issue.Issue) error {
+	found, err := controller.Repo.GetProject(item.ProjectID)
+	if err != nil {
+		return apperr.From(err, "project not found")
+	}
+	if found.Blocked {
+		return apperr.NewConflict("project_blocked", "project is blocked")
+	}
+	return nil
+}
+
+// ExcludeBlocked removes blocked projects from a project_id filter. A nil
+// scope stands for all projects.
+func (controller *Controller) ExcludeBlocked(scope []string) ([]string, error) {
+	if scope == nil {
+		ids, err := controller.Repo.ProjectIDs(false)
+		if err != nil {
+			return nil, err
+		}
+		open := []string{"0"}
+		for _, id := range ids {
+			open = append(open, strconv.FormatUint(uint64(id), 10))
+		}
+		return open, nil
+	}
+
+	ids, err := controller.Repo.ProjectIDs(true)
+	if err != nil {
+		return nil, err
+	}
+	open := []string{"0"}
+	for _, id := range scope {
+		parsed, err := strconv.ParseUint(id, 10, 32)
+		if err == nil && slices.Contains(ids, uint(parsed)) {
+			continue
+		}
+		open = append(open, id)
+	}
+	return open, nil
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/issue"
+	"charts/domain/project"
+	"charts/domain/user"
+	"charts/domain/validation"
+	"errors"
+	"gorm.io/gorm"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ValidateIssues checks the issue payloads and the users and projects they
+// reference, and returns the issues ready to be stored. Field errors of a
+// batch are prefixed with the index of the payload.
+func (controller *Controller) ValidateIssues(dtos []issue.DTOissue, batch bool) ([]issue.Issue, error) {
+	var errs validation.Errors
+	var userIDs, projectIDs []uint
+
+	itemErrs := make([]validation.Errors, len(dtos))
+	for i, dto := range dtos {
+		itemErrs[i] = dto.Validate()
+		userIDs = append(userIDs, dto.UserID)
+		userIDs = append(userIDs, dto.Watchers...)
+		projectIDs = append(projectIDs, dto.ProjectID)
+	}
+
+	users, err := controller.Repo.UsersByID(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	usersByID := make(map[uint]user.User, len(users))
+	for _, item := range users {
+		usersByID[item.ID] = item
+	}
+
+	projects, err := controller.Repo.ProjectsByID(projectIDs)
+	if err != nil {
+		return nil, err
+	}
+	projectsByID := make(map[uint]project.Project, len(projects))
+	for _, item := range projects {
+		projectsByID[item.ID] = item
+	}
+	custom, err := controller.Repo.ProjectStatuses(projectIDs)
+	if err != nil {
+		return nil, err
+	}
+	var blocked validation.Errors
+
+	issues := make([]issue.Issue, 0, len(dtos))
+	for i, dto := range dtos {
+		if _, ok := usersByID[dto.UserID]; dto.UserID != 0 && !ok {
+			itemErrs[i].Add("user_id", "user does not exist")
+		}
+		if found, ok := projectsByID[dto.ProjectID]; dto.ProjectID != 0 && !ok {
+			itemErrs[i].Add("project_id", "project does not exist")
+		} else if statuses := controller.Workflow.Statuses(custom[dto.ProjectID]); dto.Status != "" && !slices.Contains(statuses, dto.Status) {
+			itemErrs[i].Add("status", unknownStatus(statuses))
+		} else if found.Blocked {
+			if batch {
+				blocked.Add("["+strconv.Itoa(i)+"].project_id", "project is blocked")
+			} else {
+				blocked.Add("project_id", "project is blocked")
+			}
+		}
+
+		var watchers []user.User
+		for _, id := range dto.Watchers {
+			watcher, ok := usersByID[id]
+			if !ok {
+				itemErrs[i].Add("watchers", "user does not exist")
+				continue
+			}
+			watchers = append(watchers, watcher)
+		}
+
+		if batch {
+			errs.Merge(i, itemErrs[i])
+		} else {
+			errs = append(errs, itemErrs[i]...)
+		}
+		if len(itemErrs[i]) > 0 {
+			continue
+		}
+
+		deadline, _ := time.Parse(issue.DeadlineLayout, dto.Deadline)
+		issues = append(issues, *controller.Domain.CreateIssue(dto.Title, dto.UserID, dto.ProjectID, dto.Priority, dto.Status, deadline, watchers))
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if len(blocked) > 0 {
+		return nil, apperr.NewConflict("project_blocked", "project is blocked", blocked...)
+	}
+	return issues, nil
+}
+
+func validateProjects(projects []project.Project) error {
+	var errs validation.Errors
+	for i, item := range projects {
+		errs.Merge(i, item.Validate())
+	}
+	return errs.Err()
+}
+
+// ValidatePatch checks an issue patch and the records it references, and
+// returns the new watchers when the patch replaces them. Moving an issue
+// requires the reporter role in the target project, which must not be
+// blocked.
+func (controller *Controller) ValidatePatch(actor *user.User, dto issue.DTOPatch) ([]user.User, error) {
+	errs := dto.Validate()
+
+	if dto.UserID != nil && *dto.UserID != 0 {
+		if _, err := controller.Repo.GetUser(*dto.UserID); errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("user_id", "user does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var watchers []user.User
+	if dto.Watchers != nil {
+		found, err := controller.Repo.UsersByID(*dto.Watchers)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) != len(slices.Compact(slices.Sorted(slices.Values(*dto.Watchers)))) {
+			errs.Add("watchers", "user does not exist")
+		}
+		watchers = found
+	}
+
+	var target *project.Project
+	if dto.ProjectID != nil && *dto.ProjectID != 0 {
+		found, err := controller.Repo.GetProject(*dto.ProjectID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("project_id", "project does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+		target = found
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	if target != nil {
+		if err := controller.Authorize(actor, target.ID, project.RoleReporter); err != nil {
+			return nil, err
+		}
+		if target.Blocked {
+			return nil, apperr.NewConflict("project_blocked", "project is blocked", apperr.FieldError{
+				Field:   "project_id",
+				Message: "project is blocked",
+			})
+		}
+	}
+
+	return watchers, nil
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/project"
+	"charts/domain/user"
+	"charts/domain/webhook"
+	"charts/infra"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// DeliveryLogSize is the number of deliveries shown per subscription.
+const DeliveryLogSize = 100
+
+// ResolveTimeout bounds the DNS lookup of a new webhook URL.
+const ResolveTimeout = 5 * time.Second
+
+// authorizeSubscription requires the project admin role for a project
+// subscription and the global admin role for a global one.
+func (controller *Controller) authorizeSubscription(actor *user.User, projectID *uint) error {
+	if projectID == nil {
+		return requireAdmin(actor)
+	}
+	return controller.Authorize(actor, *projectID, project.RoleAdmin)
+}
+
+// AddSubscription registers a webhook and returns it with its signing
+// secret, which is not shown again.
+func (controller *Controller) AddSubscription(actor *user.User, dto webhook.DTOSubscription) (*webhook.DTOView, error) {
+	if err := dto.Validate().Err(); err != nil {
+		return nil, err
+	}
+	if err := controller.authorizeSubscription(actor, dto.ProjectID); err != nil {
+		return nil, err
+	}
+	if dto.ProjectID != nil {
+		if _, err := controller.Repo.GetProject(*dto.ProjectID); err != nil {
+			return nil, apperr.From(err, "project not found")
+		}
+	}
+	if err := checkWebhookURL(dto.URL); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	events := slices.Compact(slices.Sorted(slices.Values(dto.Events)))
+	subscription := controller.Domain.CreateSubscription(dto.ProjectID, dto.URL, hex.EncodeToString(secret), events, actor.ID)
+	if err := controller.Repo.CreateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	view := webhook.View(*subscription)
+	view.Secret = subscription.Secret
+	return &view, nil
+}
+
+// checkWebhookURL resolves the host of a validated webhook URL and refuses
+// it unless every address is public. Deliveries check again on connect,
+// since the DNS answer may change.
+func checkWebhookURL(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ResolveTimeout)
+	defer cancel()
+
+	err = infra.CheckWebhookHost(ctx, target.Hostname())
+	switch {
+	case errors.Is(err, infra.ErrBlockedAddress):
+		return apperr.NewValidation("invalid_url", "webhook URL is not allowed", apperr.FieldError{
+			Field:   "url",
+			Message: "must not point to a loopback, private or link-local address",
+		})
+	case err != nil:
+		return apperr.NewValidation("invalid_url", "webhook URL is not allowed", apperr.FieldError{
+			Field:   "url",
+			Message: "host could not be resolved",
+		})
+	}
+	return nil
+}
+
+// ListSubscriptions returns the webhooks of a project, or every webhook
+// when projectID is nil.
+func (controller *Controller) ListSubscriptions(actor *user.User, projectID *uint) ([]webhook.DTOView, error) {
+	if err := controller.authorizeSubscription(actor, projectID); err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := controller.Repo.ListSubscriptions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]webhook.DTOView, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		views = append(views, webhook.View(subscription))
+	}
+	return views, nil
+}
+
+func (controller *Controller) getSubscription(actor *user.User, id uint) (*webhook.Subscription, error) {
+	subscription, err := controller.Repo.GetSubscription(id)
+	if err != nil {
+		return nil, apperr.From(err, "webhook not found")
+	}
+	if err := controller.authorizeSubscription(actor, subscription.ProjectID); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (controller *Controller) DeleteSubscription(actor *user.User, id uint) error {
+	if _, err := controller.getSubscription(actor, id); err != nil {
+		return err
+	}
+	return controller.Repo.DeleteSubscription(id)
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first.
+func (controller *Controller) ListDeliveries(actor *user.User, subscriptionID uint) ([]webhook.Delivery, error) {
+	if _, err := controller.getSubscription(actor, subscriptionID); err != nil {
+		return nil, err
+	}
+	return controller.Repo.ListDeliveries(subscriptionID, DeliveryLogSize)
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one. The
+// earlier delivery stays in the log unchanged.
+func (controller *Controller) Redeliver(actor *user.User, deliveryID uint) (*webhook.Delivery, error) {
+	delivery, err := controller.Repo.GetDelivery(deliveryID)
+	if err != nil {
+		return nil, apperr.From(err, "delivery not found")
+	}
+	if _, err := controller.getSubscription(actor, delivery.SubscriptionID); err != nil {
+		return nil, err
+	}
+
+	redelivery := &webhook.Delivery{
+		SubscriptionID: delivery.SubscriptionID,
+		Event:          delivery.Event,
+		Payload:        delivery.Payload,
+		Status:         webhook.StatusPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := controller.Repo.CreateDelivery(redelivery); err != nil {
+		return nil, err
+	}
+	return redelivery, nil
+}
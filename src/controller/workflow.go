@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain"
+	"charts/domain/issue"
+	"charts/domain/project"
+	"charts/domain/user"
+	"charts/domain/validation"
+	"charts/domain/workflow"
+	"slices"
+	"strings"
+)
+
+// NewWorkflow returns the default workflow with its transition hooks.
+func NewWorkflow(d *domain.Domain) *workflow.Workflow {
+	flow := workflow.New()
+	flow.OnTransition(reopenComment(d))
+	return flow
+}
+
+// reopenComment adds a comment by the admin who reopened a canceled issue,
+// so the reopen stands out in the comment thread and not only in the
+// history.
+func reopenComment(d *domain.Domain) workflow.Hook {
+	return func(tx workflow.Store, change workflow.Change) error {
+		if change.From != workflow.StatusCanceled || change.To != workflow.StatusOpen || change.Actor == nil {
+			return nil
+		}
+		return tx.CreateComment(d.CreateComment(change.IssueID, nil, change.Actor, "Reopened after being canceled."))
+	}
+}
+
+// ProjectStatuses returns every status the issues of the project may have.
+func (controller *Controller) ProjectStatuses(actor *user.User, projectID uint) ([]string, error) {
+	if err := controller.Authorize(actor, projectID, project.RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := controller.Repo.GetProject(projectID); err != nil {
+		return nil, apperr.From(err, "project not found")
+	}
+
+	custom, err := controller.Repo.ProjectStatuses([]uint{projectID})
+	if err != nil {
+		return nil, err
+	}
+	return controller.Workflow.Statuses(custom[projectID]), nil
+}
+
+func (controller *Controller) AddProjectStatus(actor *user.User, projectID uint, dto workflow.DTOStatus) (*workflow.ProjectStatus, error) {
+	if err := controller.Authorize(actor, projectID, project.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if _, err := controller.Repo.GetProject(projectID); err != nil {
+		return nil, apperr.From(err, "project not found")
+	}
+	if err := dto.Validate().Err(); err != nil {
+		return nil, err
+	}
+
+	status := &workflow.ProjectStatus{ProjectID: projectID, Name: dto.Name}
+	if err := controller.Repo.CreateProjectStatus(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// RemoveProjectStatus deletes a custom status that no issue of the project
+// uses any more.
+func (controller *Controller) RemoveProjectStatus(actor *user.User, projectID uint, name string) error {
+	if err := controller.Authorize(actor, projectID, project.RoleAdmin); err != nil {
+		return err
+	}
+
+	used, err := controller.Repo.StatusInUse(projectID, name)
+	if err != nil {
+		return err
+	}
+	if used {
+		return apperr.NewConflict("status_in_use", "status is used by issues of the project")
+	}
+	return controller.Repo.DeleteProjectStatus(projectID, name)
+}
+
+func unknownStatus(statuses []string) string {
+	return "must be one of " + strings.Join(statuses, ", ")
+}
+
+// checkTransition verifies that the patched issue has a status of its
+// project and that the workflow allows the actor to move it there.
+func (controller *Controller) checkTransition(actor *user.User, oldIssue *issue.Issue, updatedIssue *issue.Issue) error {
+	if oldIssue.Status == updatedIssue.Status && oldIssue.ProjectID == updatedIssue.ProjectID {
+		return nil
+	}
+
+	custom, err := controller.Repo.ProjectStatuses([]uint{oldIssue.ProjectID, updatedIssue.ProjectID})
+	if err != nil {
+		return err
+	}
+	statuses := controller.Workflow.Statuses(custom[updatedIssue.ProjectID])
+	if !slices.Contains(statuses, updatedIssue.Status) {
+		var errs validation.Errors
+		errs.Add("status", unknownStatus(statuses))
+		return errs.Err()
+	}
+	if oldIssue.Status == updatedIssue.Status {
+		return nil
+	}
+
+	transition, ok := controller.Workflow.Find(oldIssue.Status, updatedIssue.Status, slices.Concat(custom[oldIssue.ProjectID], custom[updatedIssue.ProjectID]))
+	if !ok {
+		return apperr.NewConflict("transition_not_allowed", "status cannot change from "+oldIssue.Status+" to "+updatedIssue.Status, apperr.FieldError{
+			Field:   "status",
+			Message: "transition is not allowed",
+		})
+	}
+	if transition.Admin {
+		return controller.Authorize(actor, oldIssue.ProjectID, project.RoleAdmin)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"charts/apperr"
+	"charts/domain/issue"
+	"charts/domain/user"
+	"charts/domain/workflow"
+	"charts/infra"
+	"errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// dryRunController returns a controller whose queries are built but never
+// sent, so they find no rows.
+func dryRunController(t *testing.T) *Controller {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test@tcp(127.0.0.1:1)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Controller{Repo: &infra.Repository{DB: db}, Workflow: workflow.New()}
+}
+
+func TestCheckTransition(t *testing.T) {
+	controller := dryRunController(t)
+	admin := &user.User{Email: "admin@example.com", Admin: true}
+	admin.ID = 1
+
+	tests := []struct {
+		name     string
+		actor    *user.User
+		from, to string
+		kind     *apperr.Kind
+	}{
+		{"unchanged", nil, workflow.StatusOpen, workflow.StatusOpen, nil},
+		{"allowed", nil, workflow.StatusOpen, workflow.StatusClosed, nil},
+		{"reopen closed", nil, workflow.StatusClosed, workflow.StatusOpen, nil},
+		{"not allowed", admin, workflow.StatusClosed, workflow.StatusCanceled, kind(apperr.Conflict)},
+		{"unknown status", admin, workflow.StatusOpen, "review", kind(apperr.Validation)},
+		{"reopen canceled as admin", admin, workflow.StatusCanceled, workflow.StatusOpen, nil},
+		{"reopen canceled anonymously", nil, workflow.StatusCanceled, workflow.StatusOpen, kind(apperr.Forbidden)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldIssue := &issue.Issue{ProjectID: 1, Status: test.from}
+			updatedIssue := &issue.Issue{ProjectID: 1, Status: test.to}
+			err := controller.checkTransition(test.actor, oldIssue, updatedIssue)
+
+			var appErr *apperr.Error
+			switch {
+			case test.kind == nil && err != nil:
+				t.Errorf("checkTransition = %v, want nil", err)
+			case test.kind != nil && (!errors.As(err, &appErr) || appErr.Kind != *test.kind):
+				t.Errorf("checkTransition = %v, want kind %d", err, *test.kind)
+			}
+		})
+	}
+}
+
+func kind(value apperr.Kind) *apperr.Kind {
+	return &value
+}
@@ -0,0 +1,25 @@
+package comment
+
+import (
+	"charts/domain/issue"
+	"charts/domain/user"
+	"gorm.io/gorm"
+)
+
+// Comment is a Markdown message on an issue. A comment with a parent is a
+// reply in the parent's thread.
+type Comment struct {
+	gorm.Model
+	ID uint `gorm:"primaryKey"`
+	IssueID uint `gorm:"index"`
+	Issue issue.Issue `gorm:"foreignKey:IssueID"`
+	ParentID *uint
+	Parent *Comment `gorm:"foreignKey:ParentID"`
+	AuthorID uint
+	Author user.User `gorm:"foreignKey:AuthorID"`
+	Body string `gorm:"type:TEXT"`
+}
+
+func (Comment) TableName() string {
+	return "issue_comments"
+}
@@ -0,0 +1,50 @@
+package comment
+
+import (
+	"charts/domain/user"
+	"encoding/json"
+	"time"
+)
+
+type DTOComment struct {
+	Body     string `json:"body"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+}
+
+// DTOView is a comment as returned by the API. Deleted comments keep their
+// place in the thread without a body.
+type DTOView struct {
+	ID        uint          `json:"id"`
+	ParentID  *uint         `json:"parent_id"`
+	Author    *user.DTOUser `json:"author"`
+	Body      string        `json:"body"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Deleted   bool          `json:"deleted"`
+}
+
+// DTOTimelineEntry is either a field change or a comment of an issue.
+type DTOTimelineEntry struct {
+	Type      string          `json:"type"`
+	ID        uint            `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Actor     *user.DTOUser   `json:"actor"`
+	Changes   json.RawMessage `json:"changes,omitempty"`
+	Comment   *DTOView        `json:"comment,omitempty"`
+}
+
+func View(item *Comment) DTOView {
+	view := DTOView{
+		ID:        item.ID,
+		ParentID:  item.ParentID,
+		Author:    &user.DTOUser{ID: item.Author.ID, Email: item.Author.Email},
+		Body:      item.Body,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+	if item.DeletedAt.Valid {
+		view.Body = ""
+		view.Deleted = true
+	}
+	return view
+}
@@ -0,0 +1,24 @@
+package comment
+
+import (
+	"charts/domain/validation"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxBodyLength = 10000
+
+func (dto DTOComment) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if strings.TrimSpace(dto.Body) == "" {
+		errs.Add("body", "is required")
+	} else if utf8.RuneCountInString(dto.Body) > MaxBodyLength {
+		errs.Add("body", "must be at most 10000 characters")
+	}
+	if dto.ParentID != nil && *dto.ParentID == 0 {
+		errs.Add("parent_id", "must be a positive integer")
+	}
+
+	return errs
+}
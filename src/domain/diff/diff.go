@@ -2,6 +2,7 @@ package diff
 
 import (
 	"charts/domain/issue"
+	"charts/domain/user"
 	"gorm.io/gorm"
 )
 
@@ -12,4 +13,15 @@ type CommentsDiff struct {
 	IssueID uint
 	Issue issue.Issue `gorm:"foreignKey:IssueID"`
 	Result []byte `gorm:"type:json"`
+	ActorID *uint
+	Actor *user.User `gorm:"foreignKey:ActorID"`
+}
+
+type ProjectDiff struct {
+	gorm.Model
+	ID uint `gorm:"primaryKey"`
+	ProjectID uint
+	Result []byte `gorm:"type:json"`
+	ActorID *uint
+	Actor *user.User `gorm:"foreignKey:ActorID"`
 }
@@ -0,0 +1,14 @@
+package diff
+
+import (
+	"charts/domain/user"
+	"encoding/json"
+	"time"
+)
+
+type DTOHistory struct {
+	ID        uint            `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Actor     *user.DTOUser   `json:"actor"`
+	Changes   json.RawMessage `json:"changes"`
+}
@@ -1,28 +1,59 @@
 package domain
 
 import (
+	"charts/domain/comment"
 	"charts/domain/diff"
 	"charts/domain/issue"
 	"charts/domain/project"
 	"charts/domain/user"
+	"charts/domain/webhook"
+	"strings"
 	"time"
 )
 
 type Domain struct {
 }
 
-func (domain *Domain) CreateIssue(title string, user user.User, project project.Project, priority int, status string, deadline time.Time, watchers []user.User) *issue.Issue{
-	return &issue.Issue{Title: title, User: user, Project: project, Priority: priority, Status: status, Deadline: deadline, Watchers: watchers}
+func (domain *Domain) CreateIssue(title string, userID uint, projectID uint, priority int, status string, deadline time.Time, watchers []user.User) *issue.Issue{
+	return &issue.Issue{Title: title, UserID: userID, ProjectID: projectID, Priority: priority, Status: status, Deadline: deadline, Watchers: watchers, Version: 1}
 }
 
 func (domain *Domain) CreateProject(name string, blocked bool) *project.Project {
 	return &project.Project{Name: name, Blocked: blocked}
 }
 
-func (domain *Domain) CreateUser(email string) *user.User {
-	return &user.User{Email: email}
+func (domain *Domain) CreateUser(email string, passwordHash string) *user.User {
+	return &user.User{Email: email, PasswordHash: passwordHash}
 }
 
-func (domain *Domain) CreateDiff(comment []byte, id uint, updated []byte) *diff.CommentsDiff {
-	return &diff.CommentsDiff{Diff: comment, IssueID: id, Result: updated}
+func (domain *Domain) CreateDiff(comment []byte, id uint, updated []byte, actor *user.User) *diff.CommentsDiff {
+	newDiff := &diff.CommentsDiff{Diff: comment, IssueID: id, Result: updated}
+	if actor != nil {
+		newDiff.ActorID = &actor.ID
+	}
+	return newDiff
+}
+
+func (domain *Domain) CreateToken(userID uint, hash string, expiresAt time.Time) *user.AuthToken {
+	return &user.AuthToken{UserID: userID, Hash: hash, ExpiresAt: expiresAt}
+}
+
+func (domain *Domain) CreateMember(projectID uint, userID uint, role string) *project.Member {
+	return &project.Member{ProjectID: projectID, UserID: userID, Role: role}
+}
+
+func (domain *Domain) CreateProjectDiff(id uint, updated []byte, actor *user.User) *diff.ProjectDiff {
+	newDiff := &diff.ProjectDiff{ProjectID: id, Result: updated}
+	if actor != nil {
+		newDiff.ActorID = &actor.ID
+	}
+	return newDiff
+}
+
+func (domain *Domain) CreateComment(issueID uint, parentID *uint, author *user.User, body string) *comment.Comment {
+	return &comment.Comment{IssueID: issueID, ParentID: parentID, AuthorID: author.ID, Body: body}
+}
+
+func (domain *Domain) CreateSubscription(projectID *uint, url string, secret string, events []string, creatorID uint) *webhook.Subscription {
+	return &webhook.Subscription{ProjectID: projectID, URL: url, Secret: secret, Events: strings.Join(events, ","), CreatedByID: creatorID}
 }
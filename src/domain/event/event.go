@@ -0,0 +1,119 @@
+package event
+
+import (
+	"charts/domain/diff"
+	"charts/domain/issue"
+	"encoding/json"
+	"time"
+)
+
+const (
+	IssueCreated     = "issue.created"
+	IssueUpdated     = "issue.updated"
+	IssueDeleted     = "issue.deleted"
+	ProjectCreated   = "project.created"
+	ProjectBlocked   = "project.blocked"
+	ProjectUnblocked = "project.unblocked"
+	ProjectDeleted   = "project.deleted"
+	UserCreated      = "user.created"
+	UserDeleted      = "user.deleted"
+)
+
+// Event is a domain event stored in the outbox by the transaction of the
+// change it describes. Events are dispatched in ID order.
+type Event struct {
+	ID uint `gorm:"primaryKey"`
+	Name string `gorm:"size:64"`
+	ProjectID *uint
+	Payload []byte `gorm:"type:json"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Offset is the last event a consumer has handled. Attempts counts the
+// failures of the event after it. The consumer does not run before
+// NextRunAt, which is the end of the lease while an instance handles a
+// batch and the retry time after a failure.
+type Offset struct {
+	Consumer string `gorm:"primaryKey;size:64"`
+	EventID uint
+	Attempts int `gorm:"not null;default:0"`
+	NextRunAt *time.Time
+	UpdatedAt time.Time
+}
+
+func (Offset) TableName() string {
+	return "outbox_offsets"
+}
+
+// IssueChange is the payload of issue.updated and issue.deleted. The issue
+// is missing from issue.deleted.
+type IssueChange struct {
+	Issue *DTOIssue `json:"issue,omitempty"`
+	Diff  DTODiff   `json:"diff"`
+}
+
+// DTOIssue is an issue as events carry it to webhook subscribers: related
+// users and projects are referenced by ID only.
+type DTOIssue struct {
+	ID         uint      `json:"id"`
+	Title      string    `json:"title"`
+	UserID     uint      `json:"user_id"`
+	ProjectID  uint      `json:"project_id"`
+	Priority   int       `json:"priority"`
+	Status     string    `json:"status"`
+	Deadline   time.Time `json:"deadline"`
+	WatcherIDs []uint    `json:"watcher_ids"`
+	Version    uint      `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func Issue(item *issue.Issue) *DTOIssue {
+	watchers := make([]uint, 0, len(item.Watchers))
+	for _, watcher := range item.Watchers {
+		watchers = append(watchers, watcher.ID)
+	}
+	return &DTOIssue{
+		ID:         item.ID,
+		Title:      item.Title,
+		UserID:     item.UserID,
+		ProjectID:  item.ProjectID,
+		Priority:   item.Priority,
+		Status:     item.Status,
+		Deadline:   item.Deadline,
+		WatcherIDs: watchers,
+		Version:    item.Version,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.UpdatedAt,
+	}
+}
+
+// DTODiff is an issue diff with its stored JSON documents inlined.
+type DTODiff struct {
+	ID        uint            `json:"id"`
+	IssueID   uint            `json:"issue_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	ActorID   *uint           `json:"actor_id"`
+	Diff      json.RawMessage `json:"diff"`
+	Result    json.RawMessage `json:"result"`
+}
+
+func Diff(item *diff.CommentsDiff) DTODiff {
+	return DTODiff{
+		ID:        item.ID,
+		IssueID:   item.IssueID,
+		CreatedAt: item.CreatedAt,
+		ActorID:   item.ActorID,
+		Diff:      item.Diff,
+		Result:    item.Result,
+	}
+}
+
+// Deleted is the payload of the *.deleted events.
+type Deleted struct {
+	ID uint `json:"id"`
+}
@@ -16,7 +16,8 @@ type  Issue struct {
 	ProjectID uint
 	Project project.Project `gorm:"foreignKey:ProjectID"`
 	Priority int `gorm:"check:priority IN (1,2,3,4,5)"`
-	Status string `gorm:"type:VARCHAR(20);check:status IN ('open', 'in_progress', 'closed', 'canceled')"`
+	Status string `gorm:"type:VARCHAR(20)"`
 	Deadline time.Time
 	Watchers []user.User `gorm:"many2many:issue_watchers;"`
+	Version uint `gorm:"not null;default:1"`
 }
\ No newline at end of file
@@ -0,0 +1,122 @@
+package issue
+
+import (
+	"charts/domain/user"
+	"charts/domain/validation"
+	"time"
+	"unicode/utf8"
+)
+
+// DTOPatch holds a partial update of an issue. Fields left out of the
+// request stay nil and are not changed.
+type DTOPatch struct {
+	Title     *string `json:"title,omitempty"`
+	UserID    *uint   `json:"user_id,omitempty"`
+	ProjectID *uint   `json:"project_id,omitempty"`
+	Priority  *int    `json:"priority,omitempty"`
+	Status    *string `json:"status,omitempty"`
+	Deadline  *string `json:"deadline,omitempty"`
+	Watchers  *[]uint `json:"watchers,omitempty"`
+}
+
+func (dto DTOPatch) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if dto.Title != nil {
+		if *dto.Title == "" {
+			errs.Add("title", "must not be empty")
+		} else if problem := titleProblem(*dto.Title); problem != "" {
+			errs.Add("title", problem)
+		}
+	}
+	if dto.Priority != nil && (*dto.Priority < 1 || *dto.Priority > 5) {
+		errs.Add("priority", "must be between 1 and 5")
+	}
+	if dto.Status != nil {
+		if *dto.Status == "" {
+			errs.Add("status", "must not be empty")
+		} else if utf8.RuneCountInString(*dto.Status) > 20 {
+			errs.Add("status", "must be at most 20 characters")
+		}
+	}
+	if dto.Deadline != nil {
+		if _, err := time.Parse(DeadlineLayout, *dto.Deadline); err != nil {
+			errs.Add("deadline", "must be a date in DD-MM-YYYY format")
+		}
+	}
+	if dto.UserID != nil && *dto.UserID == 0 {
+		errs.Add("user_id", "must not be empty")
+	}
+	if dto.ProjectID != nil && *dto.ProjectID == 0 {
+		errs.Add("project_id", "must not be empty")
+	}
+
+	return errs
+}
+
+// Apply copies the patched fields onto the issue. The watchers must already
+// be loaded for the IDs in the patch.
+func (dto DTOPatch) Apply(item *Issue, watchers []user.User) {
+	if dto.Title != nil {
+		item.Title = *dto.Title
+	}
+	if dto.UserID != nil {
+		item.UserID = *dto.UserID
+	}
+	if dto.ProjectID != nil {
+		item.ProjectID = *dto.ProjectID
+	}
+	if dto.Priority != nil {
+		item.Priority = *dto.Priority
+	}
+	if dto.Status != nil {
+		item.Status = *dto.Status
+	}
+	if dto.Deadline != nil {
+		item.Deadline, _ = time.ParseInLocation(DeadlineLayout, *dto.Deadline, item.Deadline.Location())
+	}
+	if dto.Watchers != nil {
+		item.Watchers = watchers
+	}
+}
+
+// Changes returns the old and new value of every field in the patch, in the
+// shape stored in CommentsDiff.Result.
+func (dto DTOPatch) Changes(old *Issue, updated *Issue) map[string]interface{} {
+	changes := map[string]interface{}{}
+	change := func(field string, before interface{}, after interface{}) {
+		changes[field] = map[string]interface{}{"old": before, "new": after}
+	}
+
+	if dto.Title != nil {
+		change("title", old.Title, updated.Title)
+	}
+	if dto.UserID != nil {
+		change("user_id", old.UserID, updated.UserID)
+	}
+	if dto.ProjectID != nil {
+		change("project_id", old.ProjectID, updated.ProjectID)
+	}
+	if dto.Priority != nil {
+		change("priority", old.Priority, updated.Priority)
+	}
+	if dto.Status != nil {
+		change("status", old.Status, updated.Status)
+	}
+	if dto.Deadline != nil {
+		change("deadline", old.Deadline.Format(DeadlineLayout), updated.Deadline.Format(DeadlineLayout))
+	}
+	if dto.Watchers != nil {
+		change("watchers", watcherIDs(old.Watchers), watcherIDs(updated.Watchers))
+	}
+
+	return changes
+}
+
+func watcherIDs(watchers []user.User) []uint {
+	ids := make([]uint, 0, len(watchers))
+	for _, watcher := range watchers {
+		ids = append(ids, watcher.ID)
+	}
+	return ids
+}
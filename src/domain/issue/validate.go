@@ -0,0 +1,52 @@
+package issue
+
+import (
+	"charts/domain/validation"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const DeadlineLayout = "02-01-2006"
+
+// titleProblem checks a non-empty title. Titles end up in email subjects,
+// so control characters such as line breaks are not allowed.
+func titleProblem(title string) string {
+	if utf8.RuneCountInString(title) > 256 {
+		return "must be at most 256 characters"
+	}
+	if strings.IndexFunc(title, unicode.IsControl) >= 0 {
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+func (dto DTOissue) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if dto.Title == "" {
+		errs.Add("title", "is required")
+	} else if problem := titleProblem(dto.Title); problem != "" {
+		errs.Add("title", problem)
+	}
+	if dto.Priority < 1 || dto.Priority > 5 {
+		errs.Add("priority", "must be between 1 and 5")
+	}
+	if dto.Status == "" {
+		errs.Add("status", "is required")
+	} else if utf8.RuneCountInString(dto.Status) > 20 {
+		errs.Add("status", "must be at most 20 characters")
+	}
+	if _, err := time.Parse(DeadlineLayout, dto.Deadline); err != nil {
+		errs.Add("deadline", "must be a date in DD-MM-YYYY format")
+	}
+	if dto.UserID == 0 {
+		errs.Add("user_id", "is required")
+	}
+	if dto.ProjectID == 0 {
+		errs.Add("project_id", "is required")
+	}
+
+	return errs
+}
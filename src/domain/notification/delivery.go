@@ -0,0 +1,38 @@
+package notification
+
+import "time"
+
+// Channels a notification can be delivered through.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Delivery is one message sent, or still to be sent, through a channel.
+// Email gets a delivery per recipient; the webhook gets one delivery with
+// every recipient and an empty Recipient. A delivery is unique per event,
+// channel and recipient, so handling an event twice does not send twice.
+type Delivery struct {
+	ID uint `gorm:"primaryKey"`
+	EventID uint `gorm:"uniqueIndex:idx_notification_delivery"`
+	Channel string `gorm:"size:20;uniqueIndex:idx_notification_delivery"`
+	Recipient string `gorm:"size:256;uniqueIndex:idx_notification_delivery"`
+	Message []byte `gorm:"type:json"`
+	Status string `gorm:"type:VARCHAR(20);index:idx_notification_due"`
+	Attempts int
+	NextAttemptAt time.Time `gorm:"index:idx_notification_due"`
+	LastError string `gorm:"size:1024"`
+	DeliveredAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (Delivery) TableName() string {
+	return "notification_deliveries"
+}
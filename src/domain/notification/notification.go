@@ -0,0 +1,69 @@
+package notification
+
+import (
+	"charts/domain/event"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldChange is the old and new value of one field of an issue diff.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Message tells the recipients about a change of an issue.
+type Message struct {
+	IssueID    uint          `json:"issue_id"`
+	DiffID     uint          `json:"diff_id"`
+	Title      string        `json:"title"`
+	Actor      string        `json:"actor"`
+	Recipients []string      `json:"recipients"`
+	Changes    []FieldChange `json:"changes"`
+	Subject    string        `json:"subject"`
+	Body       string        `json:"body"`
+}
+
+// FromDiff builds the message for a stored issue diff, listing every changed
+// field with its old and new value.
+func FromDiff(item *event.DTOIssue, change event.DTODiff, actor string, recipients []string) (*Message, error) {
+	var result map[string]struct {
+		Old interface{} `json:"old"`
+		New interface{} `json:"new"`
+	}
+	if err := json.Unmarshal(change.Result, &result); err != nil {
+		return nil, err
+	}
+
+	message := &Message{
+		IssueID:    item.ID,
+		DiffID:     change.ID,
+		Title:      item.Title,
+		Actor:      actor,
+		Recipients: recipients,
+		Subject:    fmt.Sprintf("[issue #%d] %s was updated", item.ID, item.Title),
+	}
+
+	for field, values := range result {
+		message.Changes = append(message.Changes, FieldChange{Field: field, Old: values.Old, New: values.New})
+	}
+	sort.Slice(message.Changes, func(i, j int) bool {
+		return message.Changes[i].Field < message.Changes[j].Field
+	})
+
+	var body strings.Builder
+	if message.Actor != "" {
+		fmt.Fprintf(&body, "%s updated issue #%d \"%s\".\n\n", message.Actor, item.ID, item.Title)
+	} else {
+		fmt.Fprintf(&body, "Issue #%d \"%s\" was updated.\n\n", item.ID, item.Title)
+	}
+	for _, field := range message.Changes {
+		fmt.Fprintf(&body, "%s: %v -> %v\n", field.Field, field.Old, field.New)
+	}
+	message.Body = body.String()
+
+	return message, nil
+}
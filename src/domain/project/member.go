@@ -0,0 +1,43 @@
+package project
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	RoleViewer     = "viewer"
+	RoleReporter   = "reporter"
+	RoleMaintainer = "maintainer"
+	RoleAdmin      = "admin"
+)
+
+// Roles are ordered from the weakest to the strongest; every role includes
+// the permissions of the roles before it.
+var Roles = []string{RoleViewer, RoleReporter, RoleMaintainer, RoleAdmin}
+
+type Member struct {
+	ID uint `gorm:"primaryKey"`
+	ProjectID uint `gorm:"uniqueIndex:idx_project_member" json:"project_id"`
+	UserID uint `gorm:"uniqueIndex:idx_project_member" json:"user_id"`
+	Role string `gorm:"type:VARCHAR(20);check:role IN ('viewer', 'reporter', 'maintainer', 'admin')" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Member) TableName() string {
+	return "project_members"
+}
+
+// RolesAtLeast returns the role and every stronger role.
+func RolesAtLeast(role string) []string {
+	index := slices.Index(Roles, role)
+	if index < 0 {
+		return nil
+	}
+	return Roles[index:]
+}
+
+func (member Member) Allows(role string) bool {
+	return slices.Contains(RolesAtLeast(role), member.Role)
+}
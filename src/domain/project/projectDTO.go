@@ -4,3 +4,8 @@ type DTOProject struct {
     ID    uint   `json:"id"`
     Name string `json:"name"`
 }
+
+type DTOMember struct {
+    UserID uint   `json:"user_id"`
+    Role   string `json:"role"`
+}
@@ -0,0 +1,31 @@
+package project
+
+import (
+	"charts/domain/validation"
+	"unicode/utf8"
+)
+
+func (project Project) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if project.Name == "" {
+		errs.Add("name", "is required")
+	} else if utf8.RuneCountInString(project.Name) > 256 {
+		errs.Add("name", "must be at most 256 characters")
+	}
+
+	return errs
+}
+
+func (dto DTOMember) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if dto.UserID == 0 {
+		errs.Add("user_id", "is required")
+	}
+	if len(RolesAtLeast(dto.Role)) == 0 {
+		errs.Add("role", "must be one of viewer, reporter, maintainer, admin")
+	}
+
+	return errs
+}
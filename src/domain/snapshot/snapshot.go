@@ -0,0 +1,17 @@
+package snapshot
+
+import "time"
+
+type IssueDailySnapshot struct {
+	Day       time.Time `gorm:"type:date;primaryKey"`
+	IssueID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Status    string    `gorm:"type:VARCHAR(20)"`
+	UserID    uint
+	ProjectID uint
+	Priority  int
+}
+
+type SnapshotDay struct {
+	Day       time.Time `gorm:"type:date;primaryKey"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package user
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type AuthToken struct {
+	gorm.Model
+	ID uint `gorm:"primaryKey"`
+	UserID uint
+	User User `gorm:"foreignKey:UserID"`
+	Hash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+}
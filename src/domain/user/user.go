@@ -1,9 +1,24 @@
 package user
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type User struct {
 	gorm.Model
 	ID uint `gorm:"primaryKey"`
 	Email string `gorm:"size:256" json:"email"`
-}
\ No newline at end of file
+	PasswordHash string `gorm:"size:60" json:"-"`
+	Admin bool `gorm:"default:false" json:"admin"`
+}
+// Bootstrap is the single row written together with the first user, so
+// that concurrent sign-ups cannot both become the first global admin.
+type Bootstrap struct {
+	ID        uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+}
+
+func (Bootstrap) TableName() string {
+	return "user_bootstrap"
+}
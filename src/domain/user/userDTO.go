@@ -4,3 +4,13 @@ type DTOUser struct {
     ID    uint   `json:"id"`
     Email string `json:"email"`
 }
+
+type DTONewUser struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+type DTOLogin struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
@@ -0,0 +1,48 @@
+package user
+
+import "charts/domain/validation"
+
+func (user User) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if user.Email == "" {
+		errs.Add("email", "is required")
+	} else if len(user.Email) > 256 || !validation.Email(user.Email) {
+		errs.Add("email", "must be a valid email address")
+	}
+
+	return errs
+}
+
+// Validate checks a new account. The password is optional: a user created
+// without one cannot log in until it is set.
+func (dto DTONewUser) Validate() validation.Errors {
+	errs := User{Email: dto.Email}.Validate()
+
+	if problem := passwordProblem(dto.Password); dto.Password != "" && problem != "" {
+		errs.Add("password", problem)
+	}
+
+	return errs
+}
+
+// ValidatePassword checks a password that replaces the current one.
+func ValidatePassword(password string) validation.Errors {
+	var errs validation.Errors
+	if password == "" {
+		errs.Add("password", "is required")
+	} else if problem := passwordProblem(password); problem != "" {
+		errs.Add("password", problem)
+	}
+	return errs
+}
+
+func passwordProblem(password string) string {
+	if len(password) < 8 {
+		return "must be at least 8 characters"
+	}
+	if len(password) > 72 {
+		return "must be at most 72 bytes"
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"charts/apperr"
+	"net/mail"
+	"strconv"
+)
+
+// Errors collects field errors so that every problem with an input is
+// reported at once.
+type Errors []apperr.FieldError
+
+func (errs *Errors) Add(field string, message string) {
+	*errs = append(*errs, apperr.FieldError{Field: field, Message: message})
+}
+
+// Merge adds the errors of an item of a batch, prefixing every field with
+// the item's index.
+func (errs *Errors) Merge(index int, other Errors) {
+	for _, item := range other {
+		errs.Add("["+strconv.Itoa(index)+"]."+item.Field, item.Message)
+	}
+}
+
+func (errs Errors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apperr.NewValidation("validation_failed", "invalid input", errs...)
+}
+
+func Email(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+// but not covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr reports whether webhooks may be sent to addr. Loopback,
+// private, link-local, multicast and unspecified addresses are refused so
+// that subscriptions cannot reach the internal network.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// publicHost rejects the hosts that can be refused without a DNS lookup:
+// localhost and literal addresses that are not public.
+func publicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return PublicAddr(addr)
+	}
+	return true
+}
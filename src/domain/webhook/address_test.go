@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700::1111", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"ff02::1", false},
+		{"ff01::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+	}
+	for _, test := range tests {
+		if got := PublicAddr(netip.MustParseAddr(test.addr)); got != test.public {
+			t.Errorf("PublicAddr(%s) = %t, want %t", test.addr, got, test.public)
+		}
+	}
+
+	if PublicAddr(netip.Addr{}) {
+		t.Error("PublicAddr accepted the zero address")
+	}
+}
+
+func TestPublicHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		public bool
+	}{
+		{"example.com", true},
+		{"hooks.example.com.", true},
+		{"localhost", false},
+		{"LOCALHOST.", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:192.168.0.1", false},
+		{"93.184.216.34", true},
+	}
+	for _, test := range tests {
+		if got := publicHost(test.host); got != test.public {
+			t.Errorf("publicHost(%q) = %t, want %t", test.host, got, test.public)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"charts/domain/validation"
+	"net/url"
+	"slices"
+)
+
+func (dto DTOSubscription) Validate() validation.Errors {
+	var errs validation.Errors
+
+	target, err := url.Parse(dto.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		errs.Add("url", "must be an absolute http or https URL")
+	} else if len(dto.URL) > 2048 {
+		errs.Add("url", "must be at most 2048 characters")
+	} else if !publicHost(target.Hostname()) {
+		errs.Add("url", "must not point to a loopback, private or link-local address")
+	}
+	if len(dto.Events) == 0 {
+		errs.Add("events", "is required")
+	}
+	for _, event := range dto.Events {
+		if !slices.Contains(Events, event) {
+			errs.Add("events", "unknown event "+event)
+		}
+	}
+	if dto.ProjectID != nil && *dto.ProjectID == 0 {
+		errs.Add("project_id", "must be a positive integer")
+	}
+
+	return errs
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"charts/domain/event"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events are the domain events a subscription can receive.
+var Events = []string{
+	event.IssueCreated, event.IssueUpdated, event.IssueDeleted,
+	event.ProjectCreated, event.ProjectBlocked, event.ProjectUnblocked, event.ProjectDeleted,
+	event.UserCreated, event.UserDeleted,
+}
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Subscription sends the chosen events to a URL. A subscription without a
+// project receives the events of every project and the user events.
+type Subscription struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	ProjectID *uint `gorm:"index" json:"project_id"`
+	URL string `gorm:"size:2048" json:"url"`
+	Secret string `gorm:"size:64" json:"-"`
+	Events string `gorm:"size:512" json:"-"`
+	CreatedByID uint `json:"created_by_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (subscription Subscription) EventList() []string {
+	return strings.Split(subscription.Events, ",")
+}
+
+func (subscription Subscription) Wants(event string) bool {
+	return slices.Contains(subscription.EventList(), event)
+}
+
+// Delivery is one event sent, or still to be sent, to a subscription.
+type Delivery struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint `gorm:"index" json:"subscription_id"`
+	Event string `gorm:"size:64" json:"event"`
+	Payload []byte `gorm:"type:json" json:"-"`
+	Status string `gorm:"type:VARCHAR(20);index:idx_delivery_due" json:"status"`
+	Attempts int `json:"attempts"`
+	NextAttemptAt time.Time `gorm:"index:idx_delivery_due" json:"next_attempt_at"`
+	ResponseCode int `json:"response_code"`
+	LastError string `gorm:"size:1024" json:"last_error"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Sign returns the signature of a delivery sent at the given Unix time:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription
+// secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
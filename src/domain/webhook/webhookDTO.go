@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type DTOSubscription struct {
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	ProjectID *uint    `json:"project_id,omitempty"`
+}
+
+// DTOView is a subscription as returned by the API. The secret is only
+// returned when the subscription is created.
+type DTOView struct {
+	Subscription
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// DTOPayload is the body of every delivery. The ID is the one of the domain
+// event, so receivers can drop repeated deliveries.
+type DTOPayload struct {
+	ID         uint            `json:"id"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func View(subscription Subscription) DTOView {
+	return DTOView{Subscription: subscription, Events: subscription.EventList()}
+}
@@ -0,0 +1,34 @@
+package workflow
+
+import (
+	"charts/domain/validation"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var statusName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// ProjectStatus is a custom status available to the issues of one project.
+type ProjectStatus struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	ProjectID uint      `gorm:"uniqueIndex:idx_project_status" json:"project_id"`
+	Name      string    `gorm:"type:VARCHAR(20);uniqueIndex:idx_project_status" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DTOStatus struct {
+	Name string `json:"name"`
+}
+
+func (dto DTOStatus) Validate() validation.Errors {
+	var errs validation.Errors
+
+	if !statusName.MatchString(dto.Name) {
+		errs.Add("name", "must be 1 to 20 lowercase letters, digits or underscores starting with a letter")
+	} else if slices.Contains(DefaultStatuses, dto.Name) {
+		errs.Add("name", "is a default status")
+	}
+
+	return errs
+}
@@ -0,0 +1,114 @@
+package workflow
+
+import (
+	"charts/domain/comment"
+	"charts/domain/user"
+	"slices"
+)
+
+const (
+	StatusOpen       = "open"
+	StatusInProgress = "in_progress"
+	StatusClosed     = "closed"
+	StatusCanceled   = "canceled"
+)
+
+// DefaultStatuses are available in every project. Projects may add custom
+// statuses, which behave like in_progress.
+var DefaultStatuses = []string{StatusOpen, StatusInProgress, StatusClosed, StatusCanceled}
+
+// Transition allows moving an issue from one status to another. Admin
+// transitions require the admin role in the issue's project.
+type Transition struct {
+	From  string
+	To    string
+	Admin bool
+}
+
+// Change describes a status change that has been written but not yet
+// committed.
+type Change struct {
+	IssueID   uint
+	ProjectID uint
+	From      string
+	To        string
+	Actor     *user.User
+}
+
+// Store is the part of the repository a hook may write to. It is bound to
+// the transaction of the status change.
+type Store interface {
+	CreateComment(item *comment.Comment) error
+}
+
+// Hook runs inside the transaction of a status change and writes through
+// tx. Returning an error rolls the change back.
+type Hook func(tx Store, change Change) error
+
+type Workflow struct {
+	Transitions []Transition
+	hooks       []Hook
+}
+
+// New returns the default workflow: active issues move freely between open
+// and in_progress and can be closed or canceled, closed issues can be
+// reopened and only an admin can reopen a canceled issue.
+func New() *Workflow {
+	return &Workflow{Transitions: []Transition{
+		{From: StatusOpen, To: StatusInProgress},
+		{From: StatusOpen, To: StatusClosed},
+		{From: StatusOpen, To: StatusCanceled},
+		{From: StatusInProgress, To: StatusOpen},
+		{From: StatusInProgress, To: StatusClosed},
+		{From: StatusInProgress, To: StatusCanceled},
+		{From: StatusClosed, To: StatusOpen},
+		{From: StatusCanceled, To: StatusOpen, Admin: true},
+	}}
+}
+
+// OnTransition registers a hook that runs on every status change.
+func (workflow *Workflow) OnTransition(hook Hook) {
+	workflow.hooks = append(workflow.hooks, hook)
+}
+
+// Statuses returns the default statuses followed by the custom ones.
+func (workflow *Workflow) Statuses(custom []string) []string {
+	statuses := slices.Clone(DefaultStatuses)
+	for _, status := range custom {
+		if !slices.Contains(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// Find returns the transition between two statuses of a project with the
+// given custom statuses. A custom status can be reached from and left for
+// open, in_progress and every other custom status, and can be closed or
+// canceled.
+func (workflow *Workflow) Find(from string, to string, custom []string) (Transition, bool) {
+	for _, transition := range workflow.Transitions {
+		if transition.From == from && transition.To == to {
+			return transition, true
+		}
+	}
+
+	active := append([]string{StatusOpen, StatusInProgress}, custom...)
+	if slices.Contains(custom, to) && slices.Contains(active, from) {
+		return Transition{From: from, To: to}, true
+	}
+	if slices.Contains(custom, from) && (slices.Contains(active, to) || to == StatusClosed || to == StatusCanceled) {
+		return Transition{From: from, To: to}, true
+	}
+	return Transition{}, false
+}
+
+// Fire runs the registered hooks in order and stops at the first error.
+func (workflow *Workflow) Fire(tx Store, change Change) error {
+	for _, hook := range workflow.hooks {
+		if err := hook(tx, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
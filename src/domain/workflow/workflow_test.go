@@ -0,0 +1,71 @@
+package workflow
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	workflow := New()
+	custom := []string{"review", "blocked"}
+
+	tests := []struct {
+		from, to string
+		found    bool
+		admin    bool
+	}{
+		{StatusOpen, StatusInProgress, true, false},
+		{StatusOpen, StatusClosed, true, false},
+		{StatusOpen, StatusCanceled, true, false},
+		{StatusInProgress, StatusOpen, true, false},
+		{StatusInProgress, StatusClosed, true, false},
+		{StatusClosed, StatusOpen, true, false},
+		{StatusCanceled, StatusOpen, true, true},
+		{StatusClosed, StatusInProgress, false, false},
+		{StatusClosed, StatusCanceled, false, false},
+		{StatusCanceled, StatusInProgress, false, false},
+		{StatusCanceled, StatusClosed, false, false},
+		{StatusOpen, "unknown", false, false},
+		{StatusOpen, "review", true, false},
+		{StatusInProgress, "review", true, false},
+		{"review", "blocked", true, false},
+		{"review", StatusOpen, true, false},
+		{"review", StatusClosed, true, false},
+		{"review", StatusCanceled, true, false},
+		{StatusClosed, "review", false, false},
+		{StatusCanceled, "review", false, false},
+	}
+	for _, test := range tests {
+		transition, found := workflow.Find(test.from, test.to, custom)
+		if found != test.found || transition.Admin != test.admin {
+			t.Errorf("Find(%q, %q) = %+v, %t; want found %t, admin %t", test.from, test.to, transition, found, test.found, test.admin)
+		}
+	}
+}
+
+func TestFindWithoutCustomStatuses(t *testing.T) {
+	if _, found := New().Find(StatusOpen, "review", nil); found {
+		t.Error("Find allowed a custom status of another project")
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	tests := []struct {
+		custom []string
+		want   []string
+	}{
+		{nil, DefaultStatuses},
+		{[]string{"review"}, []string{StatusOpen, StatusInProgress, StatusClosed, StatusCanceled, "review"}},
+		{[]string{"review", StatusOpen, "review"}, []string{StatusOpen, StatusInProgress, StatusClosed, StatusCanceled, "review"}},
+	}
+	for _, test := range tests {
+		if got := New().Statuses(test.custom); !slices.Equal(got, test.want) {
+			t.Errorf("Statuses(%q) = %q, want %q", test.custom, got, test.want)
+		}
+	}
+
+	New().Statuses([]string{"review"})
+	if len(DefaultStatuses) != 4 {
+		t.Errorf("Statuses changed DefaultStatuses to %q", DefaultStatuses)
+	}
+}
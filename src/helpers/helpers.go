@@ -1,11 +1,11 @@
 package helpers
 
 import (
-	"charts/domain/diff"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 )
 
 func GenerateCacheKey(jsonStr []byte) string {
@@ -13,33 +13,81 @@ func GenerateCacheKey(jsonStr []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func FindStatus(diff *diff.CommentsDiff, comment string) (string, error) {
-	var status string
-	var jsonData  []byte
-	var resultMap map[string]interface{}
+const maxChartPoints = 1000
 
-	jsonData = diff.Result
-	if err := json.Unmarshal(jsonData, &resultMap); err != nil {
-		return "", err
+var dateLayouts = []string{
+	"02-01-2006 15:04",
+	"02-01-2006",
+	time.RFC3339,
+}
+
+func ParseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return date, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("error: cannot parse date %q, expected DD-MM-YYYY, DD-MM-YYYY HH:MM or RFC3339", value)
+}
+
+func Buckets(from time.Time, to time.Time, interval string) ([]time.Time, error) {
+	var step func(i int) time.Time
 
-	result, ok := resultMap["status"].(map[string]interface{})
-	if !ok {
-		return "", errors.New("error: the 'status' field missing or has an incorrect format")
+	switch interval {
+	case "hour":
+		step = func(i int) time.Time { return from.Add(time.Duration(i) * time.Hour) }
+	case "day", "":
+		step = func(i int) time.Time { return from.AddDate(0, 0, i) }
+	case "week":
+		step = func(i int) time.Time { return from.AddDate(0, 0, 7*i) }
+	case "month":
+		step = func(i int) time.Time { return from.AddDate(0, i, 0) }
+	default:
+		return nil, fmt.Errorf("error: unknown interval %q", interval)
 	}
 
-	switch comment {
-	case "new":
-		status, ok = result["new"].(string)
-		if !ok {
-			return "", errors.New("error: the 'new' field missing or has an incorrect format")
+	if to.Before(from) {
+		return nil, errors.New("error: 'from' must not be after 'to'")
+	}
+
+	var dates []time.Time
+	for i := 0; ; i++ {
+		date := step(i)
+		if date.After(to) {
+			break
 		}
-	case "old":
-		status, ok = result["old"].(string)
-		if !ok {
-			return "", errors.New("error: the 'new' field missing or has an incorrect format")
+		if len(dates) == maxChartPoints {
+			return nil, fmt.Errorf("error: range produces more than %d points", maxChartPoints)
 		}
+		dates = append(dates, date)
 	}
 
-	return status, nil
+	if last := dates[len(dates)-1]; last.Before(to) {
+		if len(dates) == maxChartPoints {
+			return nil, fmt.Errorf("error: range produces more than %d points", maxChartPoints)
+		}
+		dates = append(dates, to)
+	}
+
+	return dates, nil
+}
+
+func StartOfDay(date time.Time) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+}
+
+func DayKey(date time.Time) string {
+	return date.Format("2006-01-02")
+}
+
+// Backoff returns the wait before the next attempt after the given number
+// of failed attempts: 30 seconds, doubling up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+	return min(wait, 6*time.Hour)
 }
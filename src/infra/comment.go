@@ -0,0 +1,41 @@
+package infra
+
+import (
+	"charts/domain/comment"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (repo *Repository) CreateComment(item *comment.Comment) error {
+	result := (*repo.DB).Omit(clause.Associations).Create(item)
+	return result.Error
+}
+
+func (repo *Repository) GetComment(issueID uint, id uint) (item *comment.Comment, err error) {
+	result := (*repo.DB).Where("issue_id = ?", issueID).Preload("Author").First(&item, id)
+	return item, result.Error
+}
+
+// ListComments returns the comments of the issue in the order they were
+// written. Deleted comments are included so that their replies keep their
+// place in the thread.
+func (repo *Repository) ListComments(issueID uint) (items []*comment.Comment, err error) {
+	result := (*repo.DB).Unscoped().Where("issue_id = ?", issueID).Preload("Author").Order("created_at, id").Find(&items)
+	return items, result.Error
+}
+
+func (repo *Repository) UpdateComment(id uint, body string) error {
+	result := (*repo.DB).Model(&comment.Comment{}).Where("id = ?", id).Update("body", body)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (repo *Repository) DeleteComment(id uint) error {
+	result := (*repo.DB).Delete(&comment.Comment{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// dueDelivery is the part of a pending delivery that claiming compares.
+type dueDelivery struct {
+	ID            uint
+	NextAttemptAt time.Time
+}
+
+// claimDue leases up to limit deliveries of the model's table that are
+// pending and due by pushing their next attempt past the lease, so that
+// concurrent workers do not send them twice. It returns the leased IDs.
+func (repo *Repository) claimDue(model interface{}, pending string, now time.Time, limit int, lease time.Duration) ([]uint, error) {
+	var due []dueDelivery
+	result := (*repo.DB).Model(model).Select("id, next_attempt_at").
+		Where("status = ? AND next_attempt_at <= ?", pending, now).
+		Order("next_attempt_at, id").Limit(limit).Scan(&due)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	claimed := make([]uint, 0, len(due))
+	for _, delivery := range due {
+		update := (*repo.DB).Model(model).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, pending, delivery.NextAttemptAt).
+			Update("next_attempt_at", now.Add(lease))
+		if update.Error != nil {
+			return claimed, update.Error
+		}
+		if update.RowsAffected == 1 {
+			claimed = append(claimed, delivery.ID)
+		}
+	}
+	return claimed, nil
+}
+
+// runDeliveries claims the due deliveries every interval and hands them to
+// deliver one at a time. Once ctx is cancelled it stops between deliveries:
+// the rest of the batch is sent again after its lease instead of failing
+// an attempt with the dead context.
+func runDeliveries(ctx context.Context, name string, every time.Duration, claim func(now time.Time) ([]uint, error), deliver func(ctx context.Context, id uint) error) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ids, err := claim(now)
+			if err != nil {
+				log.Printf("%s claim error: %v", name, err)
+			}
+			for _, id := range ids {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := deliver(ctx, id); err != nil {
+					log.Printf("%s delivery %d: %v", name, id, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package infra
+
+import (
+	"charts/domain/project"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (repo *Repository) SaveMember(member *project.Member) error {
+	result := (*repo.DB).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(member)
+	return result.Error
+}
+
+func (repo *Repository) GetMember(projectID uint, userID uint) (member *project.Member, err error) {
+	result := (*repo.DB).Where("project_id = ? AND user_id = ?", projectID, userID).First(&member)
+	return member, result.Error
+}
+
+func (repo *Repository) ListMembers(projectID uint) (members []*project.Member, err error) {
+	result := (*repo.DB).Where("project_id = ?", projectID).Order("id").Find(&members)
+	return members, result.Error
+}
+
+func (repo *Repository) DeleteMember(projectID uint, userID uint) error {
+	result := (*repo.DB).Where("project_id = ? AND user_id = ?", projectID, userID).Delete(&project.Member{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// MemberProjectIDs returns the projects in which the user holds at least
+// one of the given roles.
+func (repo *Repository) MemberProjectIDs(userID uint, roles []string) (ids []uint, err error) {
+	result := (*repo.DB).Model(&project.Member{}).
+		Where("user_id = ? AND role IN ?", userID, roles).
+		Pluck("project_id", &ids)
+	return ids, result.Error
+}
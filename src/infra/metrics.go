@@ -0,0 +1,186 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const metricsStartKey = "metrics:start"
+
+// Metrics holds the Prometheus collectors of the application. It is also a
+// GORM plugin that times every query.
+type Metrics struct {
+	Registry     *prometheus.Registry
+	HTTPRequests *prometheus.HistogramVec
+	DBQueries    *prometheus.HistogramVec
+	DBErrors     *prometheus.CounterVec
+	ChartCache   *prometheus.CounterVec
+	LineIssues   prometheus.Histogram
+	Issues       *prometheus.GaugeVec
+	Projects     *prometheus.GaugeVec
+	Users        prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "charts_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		DBQueries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "charts_db_query_duration_seconds",
+			Help:    "Duration of database queries by operation and table.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "table"}),
+		DBErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charts_db_query_errors_total",
+			Help: "Database queries that failed, not counting record not found.",
+		}, []string{"operation", "table"}),
+		ChartCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charts_chart_cache_requests_total",
+			Help: "Chart cache lookups by result, hit or miss.",
+		}, []string{"result"}),
+		LineIssues: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "charts_line_issues_duration_seconds",
+			Help:    "Duration of computing line charts from the status history.",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}),
+		Issues: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "charts_issues",
+			Help: "Issues by status.",
+		}, []string{"status"}),
+		Projects: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "charts_projects",
+			Help: "Projects by blocked state.",
+		}, []string{"blocked"}),
+		Users: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "charts_users",
+			Help: "Users.",
+		}),
+	}
+	metrics.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.HTTPRequests,
+		metrics.DBQueries,
+		metrics.DBErrors,
+		metrics.ChartCache,
+		metrics.LineIssues,
+		metrics.Issues,
+		metrics.Projects,
+		metrics.Users,
+	)
+	return metrics
+}
+
+func (metrics *Metrics) Name() string {
+	return "metrics"
+}
+
+// Initialize registers callbacks around every kind of GORM statement.
+func (metrics *Metrics) Initialize(db *gorm.DB) error {
+	type register func(name string, fn func(*gorm.DB)) error
+	callbacks := []struct {
+		operation     string
+		before, after register
+	}{
+		{"create", db.Callback().Create().Before("*").Register, db.Callback().Create().After("*").Register},
+		{"query", db.Callback().Query().Before("*").Register, db.Callback().Query().After("*").Register},
+		{"update", db.Callback().Update().Before("*").Register, db.Callback().Update().After("*").Register},
+		{"delete", db.Callback().Delete().Before("*").Register, db.Callback().Delete().After("*").Register},
+		{"row", db.Callback().Row().Before("*").Register, db.Callback().Row().After("*").Register},
+		{"raw", db.Callback().Raw().Before("*").Register, db.Callback().Raw().After("*").Register},
+	}
+	for _, callback := range callbacks {
+		if err := callback.before("metrics:before_"+callback.operation, metrics.before); err != nil {
+			return err
+		}
+		if err := callback.after("metrics:after_"+callback.operation, metrics.after(callback.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (metrics *Metrics) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (metrics *Metrics) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, _ := value.(time.Time)
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		metrics.DBQueries.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			metrics.DBErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
+
+// CountsWorker sets the gauges of the numbers of /stat. Scrapes read the
+// last values, so they do not cost any query.
+type CountsWorker struct {
+	Repo    *Repository
+	Metrics *Metrics
+	Every   time.Duration
+}
+
+func (worker *CountsWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.Every)
+	defer ticker.Stop()
+
+	for {
+		if err := worker.refresh(); err != nil {
+			log.Printf("metrics counts error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (worker *CountsWorker) refresh() error {
+	statuses, err := worker.Repo.CountIssuesGroup("status", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	total, err := worker.Repo.CountProjects(false)
+	if err != nil {
+		return err
+	}
+	active, err := worker.Repo.CountProjects(true)
+	if err != nil {
+		return err
+	}
+	users, err := worker.Repo.CountUsers()
+	if err != nil {
+		return err
+	}
+
+	// Statuses without issues are dropped rather than kept at their last
+	// count.
+	worker.Metrics.Issues.Reset()
+	for status, count := range statuses {
+		worker.Metrics.Issues.WithLabelValues(status).Set(float64(count))
+	}
+	worker.Metrics.Projects.WithLabelValues("false").Set(float64(active))
+	worker.Metrics.Projects.WithLabelValues("true").Set(float64(total - active))
+	worker.Metrics.Users.Set(float64(users))
+	return nil
+}
@@ -0,0 +1,240 @@
+package infra
+
+import (
+	"bytes"
+	"charts/domain/notification"
+	"charts/helpers"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier delivers issue notifications to their recipients.
+type Notifier interface {
+	Notify(ctx context.Context, message *notification.Message) error
+}
+
+// SMTPNotifier emails the message to every recipient. Without a username
+// it connects without authentication, as local SMTP stubs expect.
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (notifier *SMTPNotifier) Notify(ctx context.Context, message *notification.Message) error {
+	if len(message.Recipients) == 0 {
+		return nil
+	}
+
+	// The subject comes from the issue title; line breaks in it would
+	// start new headers.
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(message.Subject)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", notifier.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(message.Recipients, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return notifier.send(ctx, message.Recipients, body.Bytes())
+}
+
+// send does what smtp.SendMail does, but dials with ctx and applies its
+// deadline to the whole conversation.
+func (notifier *SMTPNotifier) send(ctx context.Context, recipients []string, body []byte) error {
+	host, _, err := net.SplitHostPort(notifier.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", notifier.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if notifier.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", notifier.Username, notifier.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(notifier.From); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// WebhookNotifier posts the message as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (notifier *WebhookNotifier) Notify(ctx context.Context, message *notification.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("error: webhook %s responded with %s", notifier.URL, response.Status)
+	}
+	return nil
+}
+
+// EnqueueNotifications stores pending deliveries. Deliveries that already
+// exist for the same event, channel and recipient are left as they are.
+func (repo *Repository) EnqueueNotifications(deliveries []notification.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	result := (*repo.DB).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries)
+	return result.Error
+}
+
+// ClaimNotifications leases up to limit due notification deliveries and
+// returns their IDs.
+func (repo *Repository) ClaimNotifications(now time.Time, limit int, lease time.Duration) ([]uint, error) {
+	return repo.claimDue(&notification.Delivery{}, notification.StatusPending, now, limit, lease)
+}
+
+func (repo *Repository) GetNotification(id uint) (delivery *notification.Delivery, err error) {
+	result := (*repo.DB).First(&delivery, id)
+	return delivery, result.Error
+}
+
+func (repo *Repository) SaveNotification(delivery *notification.Delivery) error {
+	result := (*repo.DB).Save(delivery)
+	return result.Error
+}
+
+// NotificationWorker sends the pending notification deliveries through
+// their channel and retries failed ones with exponential backoff until
+// MaxAttempts is reached. Each attempt may take up to Timeout.
+type NotificationWorker struct {
+	Repo        *Repository
+	Channels    map[string]Notifier
+	Every       time.Duration
+	BatchSize   int
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+func (worker *NotificationWorker) Run(ctx context.Context) {
+	claim := func(now time.Time) ([]uint, error) {
+		return worker.Repo.ClaimNotifications(now, worker.BatchSize, worker.Timeout+time.Minute)
+	}
+	runDeliveries(ctx, "notification", worker.Every, claim, worker.deliver)
+}
+
+// deliver hands a claimed delivery to its channel and stores the outcome.
+// An attempt cut short by shutdown is not counted.
+func (worker *NotificationWorker) deliver(ctx context.Context, id uint) error {
+	delivery, err := worker.Repo.GetNotification(id)
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	var message notification.Message
+	notifier, ok := worker.Channels[delivery.Channel]
+	switch {
+	case !ok:
+		sendErr = fmt.Errorf("error: channel %s is not configured", delivery.Channel)
+	case json.Unmarshal(delivery.Message, &message) != nil:
+		sendErr = errors.New("error: invalid message")
+	default:
+		sendCtx, cancel := context.WithTimeout(ctx, worker.Timeout)
+		sendErr = notifier.Notify(sendCtx, &message)
+		cancel()
+	}
+	if sendErr != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	delivery.Attempts++
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		delivery.Status = notification.StatusSucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= worker.MaxAttempts:
+		delivery.Status = notification.StatusFailed
+		delivery.LastError = truncate(sendErr.Error(), 1024)
+	default:
+		delivery.NextAttemptAt = now.Add(helpers.Backoff(delivery.Attempts))
+		delivery.LastError = truncate(sendErr.Error(), 1024)
+	}
+	return worker.Repo.SaveNotification(delivery)
+}
+
+func truncate(value string, size int) string {
+	if len(value) > size {
+		return value[:size]
+	}
+	return value
+}
@@ -0,0 +1,227 @@
+package infra
+
+import (
+	"charts/domain/event"
+	"context"
+	"encoding/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// appendEvent stores a domain event in the outbox through tx, which must be
+// the transaction of the change the event describes.
+func appendEvent(tx *gorm.DB, name string, projectID *uint, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&event.Event{Name: name, ProjectID: projectID, Payload: payload}).Error
+}
+
+// Consumer handles the domain events of the outbox. Events reach a consumer
+// in order and at least once, so handling an event twice must be harmless.
+type Consumer interface {
+	Name() string
+	Handle(ctx context.Context, item *event.Event) error
+}
+
+// Dispatcher feeds the outbox events to every consumer. Each consumer keeps
+// its own offset, so a failing consumer is retried without holding back the
+// others. An event that still fails after MaxAttempts is logged and skipped.
+type Dispatcher struct {
+	Repo        *Repository
+	Consumers   []Consumer
+	Every       time.Duration
+	BatchSize   int
+	Retention   time.Duration
+	MaxAttempts int
+	// Lease is how long a claimed batch is reserved for one instance.
+	Lease time.Duration
+	// Settle is how long a gap in the event IDs is waited for, see settled.
+	Settle time.Duration
+}
+
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatcher.Every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, consumer := range dispatcher.Consumers {
+				if err := dispatcher.dispatch(ctx, consumer); err != nil {
+					log.Printf("outbox consumer %s: %v", consumer.Name(), err)
+				}
+			}
+			if err := dispatcher.Repo.PruneEvents(now.Add(-dispatcher.Retention), dispatcher.names()); err != nil {
+				log.Printf("outbox prune error: %v", err)
+			}
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) names() []string {
+	names := make([]string, 0, len(dispatcher.Consumers))
+	for _, consumer := range dispatcher.Consumers {
+		names = append(names, consumer.Name())
+	}
+	return names
+}
+
+// dispatch hands the next batch of events to the consumer. The batch is
+// claimed and the offset advanced in two short statements, so no database
+// connection or lock is held while the consumer works. The offset advances
+// past every handled event even when a later one fails.
+func (dispatcher *Dispatcher) dispatch(ctx context.Context, consumer Consumer) error {
+	offset, events, err := dispatcher.claim(consumer.Name())
+	if err != nil || len(events) == 0 {
+		return err
+	}
+
+	start := time.Now()
+	handled := offset.EventID
+	var failed *event.Event
+	var handleErr error
+	for i := range events {
+		// Leave the rest of the batch to the next run before the lease
+		// could run out.
+		if time.Since(start) > dispatcher.Lease/2 {
+			break
+		}
+		if handleErr = consumer.Handle(ctx, &events[i]); handleErr != nil {
+			failed = &events[i]
+			break
+		}
+		handled = events[i].ID
+	}
+
+	return dispatcher.release(consumer.Name(), offset, handled, failed, handleErr)
+}
+
+// claim reads the next batch of the consumer and leases it by moving the
+// consumer's next run past the lease. It returns no events while the
+// consumer is leased by another instance or waiting for a retry.
+func (dispatcher *Dispatcher) claim(consumer string) (*event.Offset, []event.Event, error) {
+	var offset *event.Offset
+	var events []event.Event
+	err := (*dispatcher.Repo.DB).Transaction(func(tx *gorm.DB) error {
+		var err error
+		offset, err = lockOffset(tx, consumer)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if offset.NextRunAt != nil && offset.NextRunAt.After(now) {
+			return nil
+		}
+
+		err = tx.Where("id > ?", offset.EventID).Order("id").Limit(dispatcher.BatchSize).Find(&events).Error
+		if err != nil {
+			return err
+		}
+		events = settled(events, offset.EventID, now.Add(-dispatcher.Settle))
+		if len(events) == 0 {
+			return nil
+		}
+		leased := now.Add(dispatcher.Lease)
+		return tx.Model(offset).Update("next_run_at", leased).Error
+	})
+	return offset, events, err
+}
+
+// release records the outcome of a claimed batch. It changes nothing when
+// another instance took the consumer over after the lease ran out.
+func (dispatcher *Dispatcher) release(consumer string, claimed *event.Offset, handled uint, failed *event.Event, handleErr error) error {
+	now := time.Now()
+	values := map[string]interface{}{"event_id": handled, "attempts": 0, "next_run_at": nil, "updated_at": now}
+	if failed != nil {
+		attempts := 1
+		if handled == claimed.EventID {
+			attempts = claimed.Attempts + 1
+		}
+		if attempts >= dispatcher.MaxAttempts {
+			log.Printf("outbox consumer %s: skipping event %d after %d attempts: %v", consumer, failed.ID, attempts, handleErr)
+			values["event_id"] = failed.ID
+			handleErr = nil
+		} else {
+			values["attempts"] = attempts
+			values["next_run_at"] = now.Add(retryBackoff(attempts))
+		}
+	}
+
+	result := (*dispatcher.Repo.DB).Model(&event.Offset{}).
+		Where("consumer = ? AND event_id = ?", consumer, claimed.EventID).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	return handleErr
+}
+
+// retryBackoff returns the wait before a consumer retries a failed event:
+// two seconds, doubling up to five minutes.
+func retryBackoff(attempts int) time.Duration {
+	return min(time.Second<<min(attempts, 9), 5*time.Minute)
+}
+
+// settled returns the events up to the first gap in their IDs that may
+// still be filled. IDs are assigned on insert but become visible on
+// commit, so a missing ID can belong to a transaction that is still
+// running; moving the offset past it would lose its event. The event after
+// the gap was inserted later, so once it is older than before the missing
+// transaction has been running for the whole settle time and is taken as
+// rolled back.
+func settled(events []event.Event, after uint, before time.Time) []event.Event {
+	for i := range events {
+		if events[i].ID != after+1 && events[i].CreatedAt.After(before) {
+			return events[:i]
+		}
+		after = events[i].ID
+	}
+	return events
+}
+
+// lockOffset locks the offset of the consumer. A new consumer starts at
+// the oldest event still in the outbox, so events written before its first
+// run are not lost.
+func lockOffset(tx *gorm.DB, consumer string) (*event.Offset, error) {
+	var offset event.Offset
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("consumer = ?", consumer).Limit(1).Find(&offset)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return &offset, result.Error
+	}
+
+	offset.Consumer = consumer
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&offset).Error; err != nil {
+		return nil, err
+	}
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("consumer = ?", consumer).First(&offset)
+	return &offset, result.Error
+}
+
+// PruneEvents deletes the events created before the given time that every
+// listed consumer has handled.
+func (repo *Repository) PruneEvents(before time.Time, consumers []string) error {
+	if len(consumers) == 0 {
+		return nil
+	}
+	var offsets []event.Offset
+	result := (*repo.DB).Where("consumer IN ?", consumers).Find(&offsets)
+	if result.Error != nil || len(offsets) < len(consumers) {
+		return result.Error
+	}
+
+	handled := offsets[0].EventID
+	for _, offset := range offsets {
+		handled = min(handled, offset.EventID)
+	}
+	if handled == 0 {
+		return result.Error
+	}
+	result = (*repo.DB).Where("id <= ? AND created_at < ?", handled, before).Delete(&event.Event{})
+	return result.Error
+}
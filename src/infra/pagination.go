@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("error: invalid cursor")
+	ErrInvalidSort   = errors.New("error: unknown sort field")
+)
+
+var (
+	issueSorts   = []string{"id", "created_at", "deadline", "priority", "status", "title"}
+	userSorts    = []string{"id", "email"}
+	projectSorts = []string{"id", "name"}
+)
+
+// ListQuery describes one page of a list endpoint. Sort is a column name,
+// prefixed with "-" for descending order; Cursor is the token returned with
+// the previous page.
+type ListQuery struct {
+	Limit      int
+	Cursor     string
+	Sort       string
+	Filters    map[string]interface{}
+	Conditions []Condition
+}
+
+type Condition struct {
+	Query string
+	Args  []interface{}
+}
+
+type cursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v,omitempty"`
+	ID    uint        `json:"id"`
+}
+
+func (query ListQuery) limit() int {
+	if query.Limit <= 0 {
+		return DefaultPageSize
+	}
+	return min(query.Limit, MaxPageSize)
+}
+
+func (query ListQuery) field() (string, bool) {
+	if query.Sort == "" {
+		return "id", false
+	}
+	field := strings.TrimPrefix(query.Sort, "-")
+	return field, field != query.Sort
+}
+
+func (query ListQuery) apply(db *gorm.DB, sorts []string) (*gorm.DB, error) {
+	field, desc := query.field()
+	if !slices.Contains(sorts, field) {
+		return nil, ErrInvalidSort
+	}
+
+	if len(query.Filters) > 0 {
+		db = db.Where(query.Filters)
+	}
+	for _, condition := range query.Conditions {
+		db = db.Where(condition.Query, condition.Args...)
+	}
+
+	op, order := ">", "ASC"
+	if desc {
+		op, order = "<", "DESC"
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor)
+		if err != nil || after.Sort != query.Sort {
+			return nil, ErrInvalidCursor
+		}
+		if field == "id" {
+			db = db.Where("id "+op+" ?", after.ID)
+		} else {
+			db = db.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", field, op, field, op), after.Value, after.Value, after.ID)
+		}
+	}
+
+	if field != "id" {
+		db = db.Order(field + " " + order)
+	}
+	return db.Order("id " + order).Limit(query.limit() + 1), nil
+}
+
+// page trims the extra row fetched by apply and builds the cursor of the
+// next page from the last item, or returns an empty cursor on the last page.
+func page[T any](items []T, query ListQuery, key func(item T, field string) (interface{}, uint)) ([]T, string) {
+	if len(items) <= query.limit() {
+		return items, ""
+	}
+	items = items[:query.limit()]
+
+	field, _ := query.field()
+	value, id := key(items[len(items)-1], field)
+	if field == "id" {
+		value = nil
+	}
+	if date, ok := value.(time.Time); ok {
+		value = date.Format("2006-01-02 15:04:05.999999")
+	}
+
+	return items, encodeCursor(cursor{Sort: query.Sort, Value: value, ID: id})
+}
+
+func encodeCursor(after cursor) string {
+	data, _ := json.Marshal(after)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var after cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return after, err
+	}
+	err = json.Unmarshal(data, &after)
+	return after, err
+}
@@ -0,0 +1,119 @@
+package infra
+
+import (
+	"charts/domain/issue"
+	"encoding/base64"
+	"errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dryRun returns a database whose statements are built but never sent.
+func dryRun(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test@tcp(127.0.0.1:1)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "", ID: 7},
+		{Sort: "-id", ID: 1},
+		{Sort: "title", Value: "a \"quoted\" title", ID: 42},
+		{Sort: "-priority", Value: float64(3), ID: 9},
+		{Sort: "created_at", Value: "2024-05-01 10:20:30.123456", ID: 3},
+	}
+	for _, want := range tests {
+		token := encodeCursor(want)
+		got, err := decodeCursor(token)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v, %v", want, got, err)
+		}
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.UTC)
+	items := []issue.Issue{{Title: "a"}, {Title: "b"}, {Title: "c"}}
+	for i := range items {
+		items[i].ID = uint(i + 1)
+		items[i].CreatedAt = created
+	}
+	key := func(item issue.Issue, field string) (interface{}, uint) {
+		if field == "created_at" {
+			return item.CreatedAt, item.ID
+		}
+		return item.Title, item.ID
+	}
+
+	rest, token := page(items, ListQuery{Limit: 3}, key)
+	if len(rest) != 3 || token != "" {
+		t.Errorf("last page = %d items, cursor %q; want 3 items, no cursor", len(rest), token)
+	}
+
+	rest, token = page(items, ListQuery{Limit: 2, Sort: "-created_at"}, key)
+	after, err := decodeCursor(token)
+	want := cursor{Sort: "-created_at", Value: "2024-05-01 10:20:30.123456", ID: 2}
+	if len(rest) != 2 || err != nil || !reflect.DeepEqual(after, want) {
+		t.Errorf("page = %d items, cursor %+v, %v; want 2 items, cursor %+v", len(rest), after, err, want)
+	}
+
+	_, token = page(items, ListQuery{Limit: 1}, key)
+	if after, _ := decodeCursor(token); after.Value != nil || after.ID != 1 {
+		t.Errorf("id cursor = %+v, want no value and id 1", after)
+	}
+}
+
+func TestApplyRejectsInvalidCursors(t *testing.T) {
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	tests := []struct {
+		name  string
+		query ListQuery
+		want  error
+	}{
+		{"unknown sort", ListQuery{Sort: "password_hash"}, ErrInvalidSort},
+		{"not base64", ListQuery{Cursor: "%%%"}, ErrInvalidCursor},
+		{"not json", ListQuery{Cursor: encode("{")}, ErrInvalidCursor},
+		{"wrong type", ListQuery{Cursor: encode(`{"s":"","id":"1"}`)}, ErrInvalidCursor},
+		{"other sort", ListQuery{Sort: "-id", Cursor: encodeCursor(cursor{Sort: "id", ID: 1})}, ErrInvalidCursor},
+		{"other direction", ListQuery{Sort: "title", Cursor: encodeCursor(cursor{Sort: "-title", Value: "a", ID: 1})}, ErrInvalidCursor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.query.apply(dryRun(t).Model(&issue.Issue{}), issueSorts)
+			if !errors.Is(err, test.want) {
+				t.Errorf("apply = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyBindsCursorValues(t *testing.T) {
+	tampered := "a' OR '1'='1"
+	query := ListQuery{Sort: "title", Cursor: encodeCursor(cursor{Sort: "title", Value: tampered, ID: 5})}
+	db, err := query.apply(dryRun(t).Model(&issue.Issue{}), issueSorts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issues []issue.Issue
+	statement := db.Find(&issues).Statement
+	if strings.Contains(statement.SQL.String(), tampered) {
+		t.Errorf("cursor value was written into the SQL: %s", statement.SQL.String())
+	}
+	if !slices.Contains(statement.Vars, interface{}(tampered)) {
+		t.Errorf("cursor value is not bound, vars %v", statement.Vars)
+	}
+}
@@ -1,19 +1,115 @@
 package infra
 
 import (
+	"charts/domain/event"
 	"context"
+	"encoding/json"
 	"github.com/redis/go-redis/v9"
+	"strconv"
 	"time"
 )
 
+// Cache tags group cached results by the data they were computed from.
+// Bumping the version of a tag changes the keys of every result that
+// depends on it, which leaves the old entries to expire.
+const (
+	IssuesTag = "issues"
+	FieldsTag = "fields"
+)
+
+func ProjectTag(id string) string {
+	return "project:" + id
+}
+
 type RedisRepository struct {
 	Client *redis.Client
+	TTL    time.Duration
 }
 
 func (r *RedisRepository) Set(ctx context.Context, key string, value string) error {
-	return r.Client.Set(ctx, key, value, 10*time.Minute).Err()
+	return r.Client.Set(ctx, key, value, r.TTL).Err()
 }
 
 func (r *RedisRepository) Get(ctx context.Context, key string) (string, error) {
 	return r.Client.Get(ctx, key).Result()
 }
+
+// Versions returns the current version of every tag; a tag that was never
+// bumped has version 0.
+func (r *RedisRepository) Versions(ctx context.Context, tags []string) ([]int64, error) {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, "version:"+tag)
+	}
+
+	values, err := r.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, len(values))
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			versions[i], _ = strconv.ParseInt(text, 10, 64)
+		}
+	}
+	return versions, nil
+}
+
+func (r *RedisRepository) Bump(ctx context.Context, tags ...string) error {
+	pipe := r.Client.Pipeline()
+	for _, tag := range tags {
+		pipe.Incr(ctx, "version:"+tag)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CacheConsumer invalidates the cached chart results touched by an outbox
+// event.
+type CacheConsumer struct {
+	Redis *RedisRepository
+}
+
+func (consumer *CacheConsumer) Name() string {
+	return "chart-cache"
+}
+
+func (consumer *CacheConsumer) Handle(ctx context.Context, item *event.Event) error {
+	var tags []string
+	switch item.Name {
+	case event.IssueCreated, event.IssueUpdated, event.IssueDeleted:
+		tags = append(tags, IssuesTag)
+	case event.ProjectBlocked, event.ProjectUnblocked:
+		// Only the project's own tag: charts that exclude blocked projects
+		// list the remaining projects in their scope.
+	case event.ProjectDeleted, event.UserDeleted:
+		tags = append(tags, IssuesTag, FieldsTag)
+	default:
+		return nil
+	}
+	if item.ProjectID != nil {
+		tags = append(tags, ProjectTag(strconv.FormatUint(uint64(*item.ProjectID), 10)))
+	}
+
+	// An issue moved to another project also changes the charts of the
+	// project it left.
+	if item.Name == event.IssueUpdated {
+		var change event.IssueChange
+		var result struct {
+			ProjectID *struct {
+				Old uint `json:"old"`
+			} `json:"project_id"`
+		}
+		if err := json.Unmarshal(item.Payload, &change); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(change.Diff.Result, &result); err != nil {
+			return err
+		}
+		if result.ProjectID != nil {
+			tags = append(tags, ProjectTag(strconv.FormatUint(uint64(result.ProjectID.Old), 10)))
+		}
+	}
+
+	return consumer.Redis.Bump(ctx, tags...)
+}
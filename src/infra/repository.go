@@ -2,9 +2,12 @@ package infra
 
 import (
 	"charts/domain/diff"
+	"charts/domain/event"
 	"charts/domain/issue"
 	"charts/domain/project"
 	"charts/domain/user"
+	"errors"
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 	"time"
 )
@@ -13,115 +16,322 @@ type Repository struct {
 	DB *gorm.DB
 }
 
+// Transaction runs fn with a repository bound to a single database
+// transaction, so that several writes commit or roll back together. The
+// transaction commits when fn returns nil.
+func (repo *Repository) Transaction(fn func(tx *Repository) error) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{DB: tx})
+	})
+}
+
+type IssueGroup struct {
+	ID        int       `gorm:"column:id"`
+	Status    string    `gorm:"column:status"`
+	UserID    uint      `gorm:"column:user_id"`
+	ProjectID uint      `gorm:"column:project_id"`
+	Priority  int       `gorm:"column:priority"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	DeletedAt *time.Time `gorm:"column:deleted_at"`
+	Reason    string     `gorm:"column:Reason"`
+}
+
+type StatusChange struct {
+	IssueID   int       `gorm:"column:issue_id"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	Old       string    `gorm:"column:old_status"`
+	New       string    `gorm:"column:new_status"`
+}
+
 type IdCount struct {
 	Reason string  `gorm:"column:Reason"`
 	Count  int     `gorm:"column:Count"`
 }
 
 func (repo *Repository) CreateIssue(issue *issue.Issue) (uint, error) {
-	result := (*repo.DB).Create(issue)
-	return issue.ID, result.Error
+	err := (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(issue).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.IssueCreated, &issue.ProjectID, event.Issue(issue))
+	})
+	return issue.ID, err
 }
 
-func (repo *Repository) CreateIssues(issues []issue.Issue) error {
-	result := (*repo.DB).Create(&issues)
-	return result.Error
+func (repo *Repository) CreateIssues(issues []issue.Issue, batchSize int) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&issues, batchSize).Error; err != nil {
+			return err
+		}
+		for i := range issues {
+			if err := appendEvent(tx, event.IssueCreated, &issues[i].ProjectID, event.Issue(&issues[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (repo *Repository) CreateUser(user *user.User) (uint, error) {
-	result := (*repo.DB).Create(user)
-	return user.ID, result.Error
+	err := (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.UserCreated, nil, user)
+	})
+	return user.ID, err
+}
+
+// ErrBootstrapClosed is returned by CreateFirstUser once a user exists.
+var ErrBootstrapClosed = errors.New("error: the first user already exists")
+
+// CreateFirstUser creates the user only while no user exists. The bootstrap
+// row is inserted first: a concurrent call blocks on its primary key and
+// then fails, and a database that had users before the row existed is
+// caught by the count.
+func (repo *Repository) CreateFirstUser(newUser *user.User) (uint, error) {
+	err := (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&user.Bootstrap{ID: 1}).Error
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrBootstrapClosed
+		}
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&user.User{}).Unscoped().Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrBootstrapClosed
+		}
+
+		if err := tx.Create(newUser).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.UserCreated, nil, newUser)
+	})
+	return newUser.ID, err
 }
 
 func (repo *Repository) CreateUsers(users []user.User) error {
-	result := (*repo.DB).Create(&users)
-	return result.Error
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&users).Error; err != nil {
+			return err
+		}
+		for i := range users {
+			if err := appendEvent(tx, event.UserCreated, nil, users[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (repo *Repository) CreateProject(project *project.Project) (uint, error) {
-	result := (*repo.DB).Create(project)
-	return project.ID, result.Error
+	err := (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(project).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.ProjectCreated, &project.ID, project)
+	})
+	return project.ID, err
 }
 
 func (repo *Repository) CreateProjects(projects []project.Project) error {
-	result := (*repo.DB).Create(&projects)
-	return result.Error
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&projects).Error; err != nil {
+			return err
+		}
+		for i := range projects {
+			if err := appendEvent(tx, event.ProjectCreated, &projects[i].ID, projects[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (repo *Repository) CreateDiff(comment *diff.CommentsDiff) (uint, error) {
+func (repo *Repository) CreateProjectDiff(comment *diff.ProjectDiff) (uint, error) {
 	result := (*repo.DB).Create(comment)
 	return comment.ID, result.Error
 }
 
-func (repo *Repository) UpdateIssue(updateIssue *issue.Issue, comments map[string]interface{}) error {
-	if titleData, ok := comments["title"].(string); ok {
-		updateIssue.Title = titleData
-	}
-
-	if priorityData, ok := comments["priority"].(float64); ok {
-		updateIssue.Priority = int(priorityData)
-	}
-
-	if statusData, ok := comments["status"].(string); ok {
-		updateIssue.Status = statusData
-	}
+func (repo *Repository) SetBlocked(id uint, blocked bool) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		var found project.Project
+		if err := tx.Model(&found).Where("id = ?", id).Update("blocked", blocked).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&found, id).Error; err != nil {
+			return err
+		}
 
-	if watchersData, ok := comments["watchers"]; ok {
-		var watcherIDs []int
-        for _, v := range watchersData.([]interface{}) {
-            if id, ok := v.(float64); ok {
-                watcherIDs = append(watcherIDs, int(id))
-			}
+		name := event.ProjectUnblocked
+		if blocked {
+			name = event.ProjectBlocked
 		}
+		return appendEvent(tx, name, &id, found)
+	})
+}
 
-        if len(watcherIDs) > 0 {
-            var users []user.User
-            (*repo.DB).Find(&users, watcherIDs)
-            if err := (*repo.DB).Model(&updateIssue).Association("Watchers").Replace(users); err != nil {
-                return err
+// ErrStaleIssue is returned by UpdateIssue when the stored issue no longer
+// has the version the update was based on.
+var ErrStaleIssue = errors.New("error: issue was modified concurrently")
+
+// UpdateIssue writes the issue only if its stored version still equals
+// updateIssue.Version and bumps the version on success. The watchers are
+// replaced when asked, and the diff is stored with the issue.updated event
+// in the same transaction.
+func (repo *Repository) UpdateIssue(updateIssue *issue.Issue, replaceWatchers bool, change *diff.CommentsDiff) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&issue.Issue{}).
+			Where("id = ? AND version = ?", updateIssue.ID, updateIssue.Version).
+			Updates(map[string]interface{}{
+				"title":      updateIssue.Title,
+				"user_id":    updateIssue.UserID,
+				"project_id": updateIssue.ProjectID,
+				"priority":   updateIssue.Priority,
+				"status":     updateIssue.Status,
+				"deadline":   updateIssue.Deadline,
+				"version":    gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStaleIssue
+		}
+		updateIssue.Version++
+
+		if replaceWatchers {
+			watchers := tx.Model(updateIssue).Association("Watchers")
+			var err error
+			if len(updateIssue.Watchers) == 0 {
+				err = watchers.Clear()
+			} else {
+				err = watchers.Replace(updateIssue.Watchers)
 			}
-        }
-	}
-
-	result := (*repo.DB).Save(&updateIssue)
+			if err != nil {
+				return err
+			}
+		}
 
-	return result.Error
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.IssueUpdated, &updateIssue.ProjectID, event.IssueChange{
+			Issue: event.Issue(updateIssue),
+			Diff:  event.Diff(change),
+		})
+	})
 }
 
-func (repo *Repository) DeleteIssue (id uint) error {
-	result := (*repo.DB).Delete(&issue.Issue{}, id)
-	return result.Error
+// DeleteIssue deletes the issue and stores the diff recording the deletion
+// with the issue.deleted event.
+func (repo *Repository) DeleteIssue(deleted *issue.Issue, change *diff.CommentsDiff) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&issue.Issue{}, deleted.ID)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.IssueDeleted, &deleted.ProjectID, event.IssueChange{Diff: event.Diff(change)})
+	})
 }
 
 func (repo *Repository) DeleteUser (id uint) error {
-	result := (*repo.DB).Delete(&user.User{}, id)
-	return result.Error
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&user.User{}, id)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&user.AuthToken{}).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, event.UserDeleted, nil, event.Deleted{ID: id})
+	})
 }
 
 func (repo *Repository) DeleteProject (id uint) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&project.Project{}, id)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return appendEvent(tx, event.ProjectDeleted, &id, event.Deleted{ID: id})
+	})
+}
 
-	result := (*repo.DB).Delete(&project.Project{}, id)
-	return result.Error
+func (repo *Repository) ListIssue (query ListQuery) (issues []*issue.Issue, next string, err error) {
+	db, err := query.apply((*repo.DB).Model(&issue.Issue{}), issueSorts)
+	if err != nil {
+		return nil, "", err
+	}
+	result := db.Preload("Watchers").Find(&issues)
+	issues, next = page(issues, query, func(item *issue.Issue, field string) (interface{}, uint) {
+		switch field {
+		case "created_at":
+			return item.CreatedAt, item.ID
+		case "deadline":
+			return item.Deadline, item.ID
+		case "priority":
+			return item.Priority, item.ID
+		case "status":
+			return item.Status, item.ID
+		case "title":
+			return item.Title, item.ID
+		}
+		return nil, item.ID
+	})
+	return issues, next, result.Error
 }
 
-func (repo *Repository) ListIssue () (issues []*issue.Issue, err error) {
-	result := (*repo.DB).Preload("Watchers").Find(&issues)
-	return issues, result.Error
+func (repo *Repository) ListUser (query ListQuery) (users []*user.DTOUser, next string, err error) {
+	db, err := query.apply((*repo.DB).Model(&user.User{}), userSorts)
+	if err != nil {
+		return nil, "", err
+	}
+	result := db.Select("id", "email").Find(&users)
+	users, next = page(users, query, func(item *user.DTOUser, field string) (interface{}, uint) {
+		return item.Email, item.ID
+	})
+	return users, next, result.Error
 }
 
-func (repo *Repository) ListIssueID () ([]int, error) {
-	var ids []int
-	result := (*repo.DB).Model(&issue.Issue{}).Pluck("id", &ids)
-	return ids, result.Error
+func (repo *Repository) ListProject (query ListQuery) (projects []*project.DTOProject, next string, err error) {
+	db, err := query.apply((*repo.DB).Model(&project.Project{}), projectSorts)
+	if err != nil {
+		return nil, "", err
+	}
+	result := db.Select("id", "name").Find(&projects)
+	projects, next = page(projects, query, func(item *project.DTOProject, field string) (interface{}, uint) {
+		return item.Name, item.ID
+	})
+	return projects, next, result.Error
 }
 
-func (repo *Repository) ListUser () (users []*user.DTOUser, err error) {
-	result := (*repo.DB).Model(&user.User{}).Select("id", "email").Find(&users)
+func (repo *Repository) UserFields (ids []uint) (users []*user.DTOUser, err error) {
+	result := (*repo.DB).Model(&user.User{}).Select("id", "email").Where("id IN ?", ids).Find(&users)
 	return users, result.Error
 }
 
-func (repo *Repository) ListProject () (projects []*project.DTOProject, err error) {
-	result := (*repo.DB).Model(&project.Project{}).Select("id", "name").Find(&projects)
+func (repo *Repository) ProjectFields (ids []uint) (projects []*project.DTOProject, err error) {
+	result := (*repo.DB).Model(&project.Project{}).Select("id", "name").Where("id IN ?", ids).Find(&projects)
 	return projects, result.Error
 }
 
@@ -130,28 +340,120 @@ func (repo *Repository) GetIssue (id uint) (issue *issue.Issue, err error) {
 	return issue, result.Error
 }
 
+func (repo *Repository) ListDiffs (issueID uint) (diffs []*diff.CommentsDiff, err error) {
+	result := (*repo.DB).Where("issue_id = ?", issueID).Preload("Actor").Order("created_at, id").Find(&diffs)
+	return diffs, result.Error
+}
+
+func (repo *Repository) ListProjectDiffs (projectID uint) (diffs []*diff.ProjectDiff, err error) {
+	result := (*repo.DB).Where("project_id = ?", projectID).Preload("Actor").Order("created_at, id").Find(&diffs)
+	return diffs, result.Error
+}
+
+func (repo *Repository) ProjectsByID (ids []uint) (projects []project.Project, err error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	result := (*repo.DB).Find(&projects, ids)
+	return projects, result.Error
+}
+
+func (repo *Repository) ProjectIDs (blocked bool) (ids []uint, err error) {
+	result := (*repo.DB).Model(&project.Project{}).Where("blocked = ?", blocked).Pluck("id", &ids)
+	return ids, result.Error
+}
+
 func (repo *Repository) GetUser (id uint) (user *user.User, err error) {
 	result := (*repo.DB).Where("id = ?", id).First(&user)
 	return user, result.Error
 }
 
+func (repo *Repository) GetUserByEmail (email string) (user *user.User, err error) {
+	result := (*repo.DB).Where("email = ?", email).Order("id").First(&user)
+	return user, result.Error
+}
+
+func (repo *Repository) TakenEmails (emails []string) (taken []string, err error) {
+	if len(emails) == 0 {
+		return nil, nil
+	}
+	result := (*repo.DB).Model(&user.User{}).Where("email IN ?", emails).Distinct().Pluck("email", &taken)
+	return taken, result.Error
+}
+
+func (repo *Repository) SetAdmin (id uint, admin bool) error {
+	result := (*repo.DB).Model(&user.User{}).Where("id = ?", id).Update("admin", admin)
+	return result.Error
+}
+
+// SetPassword stores a new password hash and deletes the user's tokens, so
+// sessions opened with the old password end.
+func (repo *Repository) SetPassword(id uint, hash string) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user.User{}).Where("id = ?", id).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", id).Delete(&user.AuthToken{}).Error
+	})
+}
+
+func (repo *Repository) CreateToken(token *user.AuthToken) error {
+	result := (*repo.DB).Create(token)
+	return result.Error
+}
+
+func (repo *Repository) FindToken(hash string) (token *user.AuthToken, err error) {
+	result := (*repo.DB).Where("hash = ? AND expires_at > ?", hash, time.Now()).Preload("User").First(&token)
+	return token, result.Error
+}
+
+func (repo *Repository) DeleteToken(hash string) error {
+	result := (*repo.DB).Where("hash = ?", hash).Delete(&user.AuthToken{})
+	return result.Error
+}
+
 func (repo *Repository) GetProject (id uint) (project *project.Project, err error) {
 	result := (*repo.DB).Where("id = ?", id).First(&project)
 	return project, result.Error
 }
 
 func (repo *Repository) UsersByID (ids []uint) (users []user.User, err error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
 	result := (*repo.DB).Find(&users, ids)
 	return users, result.Error
 }
 
-func (repo *Repository) CountIssues() (count int64, err error) {
-	result := (*repo.DB).Model(&issue.Issue{}).Count(&count)
+func (repo *Repository) ExistingIDs (model interface{}, ids []uint) (map[uint]bool, error) {
+	var found []uint
+	existing := map[uint]bool{}
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	result := (*repo.DB).Model(model).Where("id IN ?", ids).Pluck("id", &found)
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, result.Error
+}
+
+func (repo *Repository) CountIssues(excludeBlocked bool) (count int64, err error) {
+	db := (*repo.DB).Model(&issue.Issue{})
+	if excludeBlocked {
+		db = db.Where("project_id NOT IN (?)", (*repo.DB).Model(&project.Project{}).Select("id").Where("blocked = ?", true))
+	}
+	result := db.Count(&count)
 	return count, result.Error
 }
 
-func (repo *Repository) CountProjects() (count int64, err error) {
-	result := (*repo.DB).Model(&project.Project{}).Count(&count)
+func (repo *Repository) CountProjects(excludeBlocked bool) (count int64, err error) {
+	db := (*repo.DB).Model(&project.Project{})
+	if excludeBlocked {
+		db = db.Where("blocked = ?", false)
+	}
+	result := db.Count(&count)
 	return count, result.Error
 }
 
@@ -160,27 +462,29 @@ func (repo *Repository) CountUsers() (count int64, err error) {
 	return count, result.Error
 }
 
-func (repo *Repository) CountIssuesGroup(groupby string, filters map[string]string) (map[string]int, error){
-	var results []IdCount
-	idCountMap := map[string]int{}
-
-	result := (*repo.DB).Model(&issue.Issue{})
-
+func groupSelect(groupby string) (string, string) {
 	switch groupby {
 	case "user":
-		result = result.Select("CAST(user_id AS CHAR) as Reason, count(id) as Count")
-		groupby = "user_id"
+		return "CAST(user_id AS CHAR) as Reason", "user_id"
 	case "project":
-		result = result.Select("CAST(project_id AS CHAR) as Reason, count(id) as Count")
-		groupby = "project_id"
+		return "CAST(project_id AS CHAR) as Reason", "project_id"
 	case "priority":
-		result = result.Select("CAST(priority AS CHAR) as Reason, count(id) as Count")
-	case "status":
-		result = result.Select("status as Reason, count(id) as Count")
+		return "CAST(priority AS CHAR) as Reason", "priority"
+	default:
+		return "status as Reason", "status"
 	}
+}
 
+func (repo *Repository) CountIssuesGroup(groupby string, filters map[string]interface{}) (map[string]int, error){
+	var results []IdCount
+	idCountMap := map[string]int{}
 
-	result = result.Where(filters).Group(groupby).Scan(&results)
+	reason, column := groupSelect(groupby)
+	result := (*repo.DB).Model(&issue.Issue{}).
+		Select(reason + ", count(id) as Count").
+		Where(filters).
+		Group(column).
+		Scan(&results)
 
 	for _, item := range results {
 		idCountMap[item.Reason] = item.Count
@@ -189,33 +493,41 @@ func (repo *Repository) CountIssuesGroup(groupby string, filters map[string]stri
 	return idCountMap, result.Error
 }
 
-func (repo *Repository) CountIssuesLine(filter string) (int, error){
-	var result IdCount
-	err := (*repo.DB).Model(&issue.Issue{}).
-		Select("status, count(id) as Count").
-		Group("status").
-		Having("status = ?", filter).
-		Find(&result)
-	return result.Count, err.Error
+func (repo *Repository) ListIssueGroup(groupby string, filters map[string]interface{}) ([]IssueGroup, error) {
+	var groups []IssueGroup
+	reason, _ := groupSelect(groupby)
+	result := (*repo.DB).Unscoped().Model(&issue.Issue{}).
+		Select("id, status, user_id, project_id, priority, created_at, deleted_at, " + reason).
+		Where(filters).
+		Scan(&groups)
+	return groups, result.Error
 }
 
-func (repo *Repository) DiffBefore(id int, date time.Time) (diff *diff.CommentsDiff, err error){
-	result := (*repo.DB).Where("issue_id = ? AND created_at <= ?", id, date).Last(&diff)
-	return diff, result.Error
-}
-
-func (repo *Repository) DiffAfter(id int, date time.Time) (diff *diff.CommentsDiff, err error){
-	result := (*repo.DB).Where("issue_id = ? AND created_at > ?", id, date).First(&diff)
-	return diff, result.Error
-}
+func (repo *Repository) StatusHistory(filters map[string]interface{}, fn func(change StatusChange) error) error {
+	issues := (*repo.DB).Unscoped().Model(&issue.Issue{}).Select("id").Where(filters)
+
+	rows, err := (*repo.DB).Model(&diff.CommentsDiff{}).
+		Select("issue_id, created_at, " +
+			"JSON_UNQUOTE(JSON_EXTRACT(result, '$.status.old')) as old_status, " +
+			"JSON_UNQUOTE(JSON_EXTRACT(result, '$.status.new')) as new_status").
+		Where("JSON_CONTAINS_PATH(result, 'one', '$.status')").
+		Where("issue_id IN (?)", issues).
+		Order("issue_id, created_at, id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-func (repo *Repository) FindIssueStatus(id int) (string, error) {
-	var status string
-	result := (*repo.DB).
-		Model(&issue.Issue{}).
-		Select("status").
-		Where("id = ?", id).
-		Scan(&status)
+	for rows.Next() {
+		var change StatusChange
+		if err := (*repo.DB).ScanRows(rows, &change); err != nil {
+			return err
+		}
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
 
-	return status, result.Error
+	return rows.Err()
 }
@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"charts/domain/issue"
+	"charts/domain/snapshot"
+	"charts/helpers"
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+const SnapshotBatchSize = 1000
+
+type SnapshotCount struct {
+	Day    time.Time `gorm:"column:day"`
+	Reason string    `gorm:"column:Reason"`
+	Count  int       `gorm:"column:Count"`
+}
+
+func (repo *Repository) SaveSnapshots(snapshots []snapshot.IssueDailySnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	result := (*repo.DB).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		CreateInBatches(&snapshots, SnapshotBatchSize)
+	return result.Error
+}
+
+func (repo *Repository) DeleteSnapshots(days []time.Time) error {
+	if len(days) == 0 {
+		return nil
+	}
+	result := (*repo.DB).Where("day IN ?", days).Delete(&snapshot.IssueDailySnapshot{})
+	return result.Error
+}
+
+// SnapshotIssues replaces the snapshot of the given day with the current
+// state of the issues that existed at its end, and marks the day as
+// complete. Like the history replay, it counts an issue from its creation
+// until its deletion.
+func (repo *Repository) SnapshotIssues(day time.Time) error {
+	end := day.AddDate(0, 0, 1)
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("day = ?", day).Delete(&snapshot.IssueDailySnapshot{}).Error; err != nil {
+			return err
+		}
+
+		issues := tx.Unscoped().Model(&issue.Issue{}).
+			Select("? as day, id as issue_id, status, user_id, project_id, priority", day).
+			Where("created_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", end, end)
+		err := tx.Exec("INSERT INTO issue_daily_snapshots (day, issue_id, status, user_id, project_id, priority) ?", issues).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&snapshot.SnapshotDay{Day: day}).Error
+	})
+}
+
+func (repo *Repository) MarkSnapshotDays(days []time.Time) error {
+	if len(days) == 0 {
+		return nil
+	}
+	marks := make([]snapshot.SnapshotDay, 0, len(days))
+	for _, day := range days {
+		marks = append(marks, snapshot.SnapshotDay{Day: day})
+	}
+	result := (*repo.DB).Clauses(clause.OnConflict{DoNothing: true}).Create(&marks)
+	return result.Error
+}
+
+func (repo *Repository) CompleteSnapshotDays(days []time.Time) (map[string]bool, error) {
+	var stored []snapshot.SnapshotDay
+	complete := map[string]bool{}
+	if len(days) == 0 {
+		return complete, nil
+	}
+
+	result := (*repo.DB).Where("day IN ?", days).Find(&stored)
+	for _, item := range stored {
+		complete[helpers.DayKey(item.Day)] = true
+	}
+	return complete, result.Error
+}
+
+func (repo *Repository) CountSnapshots(days []time.Time, groupby string, filters map[string]interface{}) ([]SnapshotCount, error) {
+	var counts []SnapshotCount
+	reason, column := groupSelect(groupby)
+	result := (*repo.DB).Model(&snapshot.IssueDailySnapshot{}).
+		Select("day, "+reason+", count(issue_id) as Count").
+		Where("day IN ?", days).
+		Where(filters).
+		Group("day, " + column).
+		Scan(&counts)
+	return counts, result.Error
+}
+
+func (repo *Repository) FirstIssueDate() (date time.Time, err error) {
+	var first issue.Issue
+	result := (*repo.DB).Unscoped().Order("created_at").Limit(1).Find(&first)
+	return first.CreatedAt, result.Error
+}
+
+// SnapshotJob writes the daily snapshot of all issues whenever the local day
+// rolls over.
+type SnapshotJob struct {
+	Repo  *Repository
+	Every time.Duration
+}
+
+func (job *SnapshotJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(job.Every)
+	defer ticker.Stop()
+
+	today := helpers.StartOfDay(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			day := helpers.StartOfDay(now)
+			if !day.After(today) {
+				continue
+			}
+			if err := job.Repo.SnapshotIssues(today); err != nil {
+				log.Printf("snapshot error for %s: %v", helpers.DayKey(today), err)
+				continue
+			}
+			today = day
+		}
+	}
+}
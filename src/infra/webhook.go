@@ -0,0 +1,275 @@
+package infra
+
+import (
+	"bytes"
+	"charts/domain/event"
+	"charts/domain/webhook"
+	"charts/helpers"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// WebhookLease is how long a claimed delivery stays hidden from other
+// workers while it is being sent.
+const WebhookLease = 2 * time.Minute
+
+func (repo *Repository) CreateSubscription(subscription *webhook.Subscription) error {
+	result := (*repo.DB).Create(subscription)
+	return result.Error
+}
+
+func (repo *Repository) GetSubscription(id uint) (subscription *webhook.Subscription, err error) {
+	result := (*repo.DB).First(&subscription, id)
+	return subscription, result.Error
+}
+
+// ListSubscriptions returns the subscriptions of a project, or every
+// subscription when projectID is nil.
+func (repo *Repository) ListSubscriptions(projectID *uint) (subscriptions []webhook.Subscription, err error) {
+	query := (*repo.DB).Order("id")
+	if projectID != nil {
+		query = query.Where("project_id = ?", *projectID)
+	}
+	result := query.Find(&subscriptions)
+	return subscriptions, result.Error
+}
+
+func (repo *Repository) DeleteSubscription(id uint) error {
+	return (*repo.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&webhook.Subscription{}, id)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Where("subscription_id = ?", id).Delete(&webhook.Delivery{}).Error
+	})
+}
+
+// WebhookConsumer turns the outbox events into webhook deliveries.
+type WebhookConsumer struct {
+	Repo *Repository
+}
+
+func (consumer *WebhookConsumer) Name() string {
+	return "webhooks"
+}
+
+func (consumer *WebhookConsumer) Handle(ctx context.Context, item *event.Event) error {
+	payload, err := json.Marshal(webhook.DTOPayload{
+		ID:         item.ID,
+		Event:      item.Name,
+		OccurredAt: item.CreatedAt,
+		Data:       item.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	return consumer.Repo.EnqueueEvent(item.Name, item.ProjectID, payload)
+}
+
+// EnqueueEvent creates a pending delivery of the payload for every
+// subscription that wants the event. Events without a project only reach
+// global subscriptions.
+func (repo *Repository) EnqueueEvent(event string, projectID *uint, payload []byte) error {
+	query := (*repo.DB).Where("project_id IS NULL")
+	if projectID != nil {
+		query = (*repo.DB).Where("project_id IS NULL OR project_id = ?", *projectID)
+	}
+	var subscriptions []webhook.Subscription
+	if err := query.Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	var deliveries []webhook.Delivery
+	for _, subscription := range subscriptions {
+		if subscription.Wants(event) {
+			deliveries = append(deliveries, webhook.Delivery{
+				SubscriptionID: subscription.ID,
+				Event:          event,
+				Payload:        payload,
+				Status:         webhook.StatusPending,
+				NextAttemptAt:  time.Now(),
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return (*repo.DB).Create(&deliveries).Error
+}
+
+func (repo *Repository) CreateDelivery(delivery *webhook.Delivery) error {
+	result := (*repo.DB).Create(delivery)
+	return result.Error
+}
+
+func (repo *Repository) GetDelivery(id uint) (delivery *webhook.Delivery, err error) {
+	result := (*repo.DB).First(&delivery, id)
+	return delivery, result.Error
+}
+
+// ListDeliveries returns the latest deliveries of a subscription, newest
+// first.
+func (repo *Repository) ListDeliveries(subscriptionID uint, limit int) (deliveries []webhook.Delivery, err error) {
+	result := (*repo.DB).Where("subscription_id = ?", subscriptionID).Order("id DESC").Limit(limit).Find(&deliveries)
+	return deliveries, result.Error
+}
+
+// ClaimDeliveries leases up to limit due webhook deliveries for
+// WebhookLease and returns their IDs.
+func (repo *Repository) ClaimDeliveries(now time.Time, limit int) ([]uint, error) {
+	return repo.claimDue(&webhook.Delivery{}, webhook.StatusPending, now, limit, WebhookLease)
+}
+
+func (repo *Repository) SaveDelivery(delivery *webhook.Delivery) error {
+	result := (*repo.DB).Save(delivery)
+	return result.Error
+}
+
+// WebhookWorker sends the pending deliveries and retries failed ones with
+// exponential backoff until MaxAttempts is reached.
+type WebhookWorker struct {
+	Repo        *Repository
+	Client      *http.Client
+	Every       time.Duration
+	BatchSize   int
+	MaxAttempts int
+}
+
+func (worker *WebhookWorker) Run(ctx context.Context) {
+	claim := func(now time.Time) ([]uint, error) {
+		return worker.Repo.ClaimDeliveries(now, worker.BatchSize)
+	}
+	runDeliveries(ctx, "webhook", worker.Every, claim, worker.deliver)
+}
+
+// deliver posts a claimed delivery to its subscription and stores the
+// outcome. An attempt cut short by shutdown is not counted.
+func (worker *WebhookWorker) deliver(ctx context.Context, id uint) error {
+	delivery, err := worker.Repo.GetDelivery(id)
+	if err != nil {
+		return err
+	}
+	subscription, err := worker.Repo.GetSubscription(delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	code, sendErr := worker.send(ctx, subscription, delivery)
+	if sendErr != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		delivery.Status = webhook.StatusSucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= worker.MaxAttempts:
+		delivery.Status = webhook.StatusFailed
+		delivery.LastError = deliveryError(delivery, code, sendErr)
+	default:
+		delivery.NextAttemptAt = now.Add(helpers.Backoff(delivery.Attempts))
+		delivery.LastError = deliveryError(delivery, code, sendErr)
+	}
+	return worker.Repo.SaveDelivery(delivery)
+}
+
+func (worker *WebhookWorker) send(ctx context.Context, subscription *webhook.Subscription, delivery *webhook.Delivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Charts-Event", delivery.Event)
+	request.Header.Set("X-Charts-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set("X-Charts-Timestamp", strconv.FormatInt(timestamp, 10))
+	request.Header.Set("X-Charts-Signature", webhook.Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := worker.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("error: responded with %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// deliveryError describes a failed attempt for the delivery log. The
+// transport error is only logged: its text names resolved hosts and ports,
+// which subscribers must not learn about.
+func deliveryError(delivery *webhook.Delivery, code int, err error) string {
+	if code != 0 {
+		return "responded with HTTP " + strconv.Itoa(code)
+	}
+	log.Printf("webhook delivery %d: %v", delivery.ID, err)
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return "address not allowed"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timed out"
+	}
+	return "connection failed"
+}
+
+// ErrBlockedAddress is returned when a webhook would connect to an address
+// that webhook.PublicAddr refuses.
+var ErrBlockedAddress = errors.New("error: webhook address is not public")
+
+// NewWebhookClient returns a client that only connects to public addresses.
+// The check runs on the resolved address of every connection, so it also
+// covers redirects and DNS rebinding. Proxies from the environment are not
+// used, since they would hide the target address.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			target, err := netip.ParseAddrPort(address)
+			if err != nil || !webhook.PublicAddr(target.Addr()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// CheckWebhookHost resolves the host of a webhook URL and fails with
+// ErrBlockedAddress when any of its addresses is not public.
+func CheckWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !webhook.PublicAddr(addr) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package infra
+
+import (
+	"context"
+	"sync"
+)
+
+// Worker is a background loop that runs until its context is cancelled.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// Workers starts the background workers and stops them together on
+// shutdown.
+type Workers struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running map[string]bool
+}
+
+// Start runs the worker in its own goroutine until Stop is called.
+func (workers *Workers) Start(name string, worker Worker) {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	if workers.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		workers.cancel = cancel
+		workers.running = map[string]bool{}
+		workers.ctx = ctx
+	}
+	workers.running[name] = true
+
+	workers.wg.Add(1)
+	go func(ctx context.Context) {
+		defer workers.wg.Done()
+		defer workers.set(name, false)
+		worker.Run(ctx)
+	}(workers.ctx)
+}
+
+func (workers *Workers) set(name string, running bool) {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	workers.running[name] = running
+}
+
+// Running reports for every started worker whether it is still running.
+func (workers *Workers) Running() map[string]bool {
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	running := make(map[string]bool, len(workers.running))
+	for name, value := range workers.running {
+		running[name] = value
+	}
+	return running
+}
+
+// Stop cancels the workers and waits for them to return until ctx is done.
+func (workers *Workers) Stop(ctx context.Context) error {
+	workers.mu.Lock()
+	if workers.cancel != nil {
+		workers.cancel()
+	}
+	workers.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
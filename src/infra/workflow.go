@@ -0,0 +1,57 @@
+package infra
+
+import (
+	"charts/domain/issue"
+	"charts/domain/workflow"
+	"gorm.io/gorm"
+)
+
+func (repo *Repository) CreateProjectStatus(status *workflow.ProjectStatus) error {
+	result := (*repo.DB).Create(status)
+	return result.Error
+}
+
+func (repo *Repository) ListProjectStatuses(projectID uint) (statuses []workflow.ProjectStatus, err error) {
+	result := (*repo.DB).Where("project_id = ?", projectID).Order("id").Find(&statuses)
+	return statuses, result.Error
+}
+
+// ProjectStatuses returns the custom status names of each project.
+func (repo *Repository) ProjectStatuses(projectIDs []uint) (map[uint][]string, error) {
+	statuses := map[uint][]string{}
+	if len(projectIDs) == 0 {
+		return statuses, nil
+	}
+
+	var rows []workflow.ProjectStatus
+	result := (*repo.DB).Where("project_id IN ?", projectIDs).Order("id").Find(&rows)
+	for _, row := range rows {
+		statuses[row.ProjectID] = append(statuses[row.ProjectID], row.Name)
+	}
+	return statuses, result.Error
+}
+
+// CustomStatuses returns the distinct custom status names of the projects,
+// or of every project when filters has no project_id.
+func (repo *Repository) CustomStatuses(filters map[string]interface{}) (names []string, err error) {
+	query := (*repo.DB).Model(&workflow.ProjectStatus{})
+	if projectIDs, ok := filters["project_id"]; ok {
+		query = query.Where("project_id IN ?", projectIDs)
+	}
+	result := query.Distinct("name").Order("name").Pluck("name", &names)
+	return names, result.Error
+}
+
+func (repo *Repository) StatusInUse(projectID uint, name string) (bool, error) {
+	var count int64
+	result := (*repo.DB).Model(&issue.Issue{}).Where("project_id = ? AND status = ?", projectID, name).Count(&count)
+	return count > 0, result.Error
+}
+
+func (repo *Repository) DeleteProjectStatus(projectID uint, name string) error {
+	result := (*repo.DB).Where("project_id = ? AND name = ?", projectID, name).Delete(&workflow.ProjectStatus{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
@@ -0,0 +1,70 @@
+package interfaces
+
+import (
+	"charts/apperr"
+	"charts/controller"
+	"charts/domain/user"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+const userKey = "user"
+
+// publicPaths are served without a user token: login, the health checks
+// and the metrics, which check a token of their own.
+var publicPaths = map[string]bool{
+	"/auth/login": true,
+	"/healthz":    true,
+	"/readyz":     true,
+	"/metrics":    true,
+}
+
+// Authenticate resolves the bearer token of every request to a user. Only
+// publicPaths are open; while no user exists, the first one may be created
+// without a token.
+func (server HttpServer) Authenticate(controller *controller.Controller) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method == http.MethodOptions || publicPaths[c.Path()] {
+				return next(c)
+			}
+
+			token := bearerToken(c)
+			if token == "" {
+				if c.Path() == "/user/add" {
+					count, err := controller.Repo.CountUsers()
+					if err != nil {
+						return server.Error(c, err)
+					}
+					if count == 0 {
+						return next(c)
+					}
+				}
+				return server.Error(c, apperr.NewUnauthorized("missing_token", "authentication required"))
+			}
+
+			current, err := controller.Authenticate(token)
+			if err != nil {
+				return server.Error(c, err)
+			}
+			c.Set(userKey, current)
+
+			return next(c)
+		}
+	}
+}
+
+func bearerToken(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func currentUser(c echo.Context) *user.User {
+	current, _ := c.Get(userKey).(*user.User)
+	return current
+}
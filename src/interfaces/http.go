@@ -1,28 +1,48 @@
 package interfaces
 
 import (
+	"charts/apperr"
 	"charts/controller"
+	"charts/domain/comment"
 	"charts/domain/issue"
 	"charts/domain/project"
 	"charts/domain/user"
+	"charts/domain/workflow"
 	"charts/helpers"
+	"charts/infra"
 	"context"
 	"encoding/json"
 	_ "fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
-const batchSize int = 1000
 
-type HttpServer struct{}
+var chartGroups = []string{"", "user", "project", "priority", "status"}
+var chartFilters = []string{"status", "priority", "project_id", "user_id"}
+
+type HttpServer struct {
+	Addr        string
+	CORSOrigins []string
+	BatchSize   int
+	Metrics     *infra.Metrics
+	// MetricsToken is the bearer token of /metrics, which is not served
+	// when it is empty.
+	MetricsToken string
+}
 
 type ChartsRequest struct {
 	GroupBy string `json:"groupBy"`
 	ChartType string `json:"chartType"`
+	From string `json:"from"`
+	To string `json:"to"`
+	Interval string `json:"interval"`
+	ExcludeBlocked bool `json:"excludeBlocked"`
 	Filters []Filter
 }
 
@@ -42,49 +62,202 @@ func (server HttpServer) Response(c echo.Context, options Options) error {
 	})
 }
 
-func (server HttpServer) HandleHttp(controller *controller.Controller) {
+// Health writes a health report, with 503 when it is not OK so load
+// balancers and orchestrators can act on the status code alone.
+func (server HttpServer) Health(c echo.Context, health *controller.Health) error {
+	status := http.StatusOK
+	if !health.OK {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, map[string]interface{}{
+		"message": "",
+		"data":    health,
+	})
+}
+
+func (server HttpServer) Error(c echo.Context, err error) error {
+	appErr := apperr.From(err, "record not found")
+
+	status := http.StatusInternalServerError
+	switch appErr.Kind {
+	case apperr.Validation:
+		status = http.StatusBadRequest
+	case apperr.NotFound:
+		status = http.StatusNotFound
+	case apperr.Conflict:
+		status = http.StatusConflict
+	case apperr.Unauthorized:
+		status = http.StatusUnauthorized
+	case apperr.Forbidden:
+		status = http.StatusForbidden
+	default:
+		c.Logger().Error("Internal error:", appErr)
+	}
+
+	body := map[string]interface{}{"code": appErr.Code}
+	if len(appErr.Fields) > 0 {
+		body["details"] = appErr.Fields
+	}
+
+	return c.JSON(status, map[string]interface{}{
+		"message": appErr.Message,
+		"data":    nil,
+		"error":   body,
+	})
+}
+
+func parseID(value string) (uint, error) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, apperr.NewValidation("invalid_id", "invalid ID", apperr.FieldError{
+			Field:   "id",
+			Message: "must be a positive integer",
+		})
+	}
+	return uint(id), nil
+}
+
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// parseIfMatch reads the issue version from an If-Match header. An absent
+// header or "*" yields 0, which skips the version check.
+func parseIfMatch(value string) (uint, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || version == 0 {
+		return 0, apperr.NewValidation("invalid_if_match", "invalid If-Match header", apperr.FieldError{
+			Field:   "If-Match",
+			Message: "must be an ETag returned by GET /issue/:id",
+		})
+	}
+	return uint(version), nil
+}
+
+// lineDates resolves the points of a line chart. Without "to" the chart
+// ends now and live is true: its last point is the current time.
+func lineDates(req ChartsRequest) (dates []time.Time, live bool, err error) {
+	to := time.Now()
+	if req.To != "" {
+		date, err := helpers.ParseDate(req.To)
+		if err != nil {
+			return nil, false, apperr.NewValidation("invalid_parameter", "invalid 'to' date format").Wrap(err)
+		}
+		to = date
+	}
+
+	from := helpers.StartOfDay(to).AddDate(0, 0, -9)
+	if req.From != "" {
+		date, err := helpers.ParseDate(req.From)
+		if err != nil {
+			return nil, false, apperr.NewValidation("invalid_parameter", "invalid 'from' date format").Wrap(err)
+		}
+		from = date
+	}
+	if req.Interval != "hour" {
+		from = helpers.StartOfDay(from)
+	}
+
+	dates, err = helpers.Buckets(from, to, req.Interval)
+	if err != nil {
+		return nil, false, apperr.NewValidation("invalid_parameter", "invalid chart range or interval").Wrap(err)
+	}
+	return dates, req.To == "" && dates[len(dates)-1].Equal(to), nil
+}
+
+// HandleHttp registers every route on a new Echo instance. The caller
+// starts and shuts down the server.
+func (server HttpServer) HandleHttp(controller *controller.Controller) *echo.Echo {
 	e := echo.New()
+	e.HideBanner = true
+
+	e.Use(server.Instrument())
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch},
+		AllowOrigins:  server.CORSOrigins,
+		AllowMethods:  []string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch},
+		ExposeHeaders: []string{"ETag"},
 	}))
 
+	e.Use(server.Authenticate(controller))
+
+	authGroup := e.Group("/auth")
 	userGroup := e.Group("/user")
 	projectGroup := e.Group("/project")
 	issueGroup := e.Group("/issue")
+	server.webhookRoutes(e.Group("/webhook"), controller)
+
+	// ***
+	// AUTH
+
+	authGroup.POST("/login", func(c echo.Context) error {
+		credentials := new(user.DTOLogin)
+		if err := c.Bind(credentials); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
+		}
+
+		token, expiresAt, err := controller.Login(credentials.Email, credentials.Password)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: map[string]interface{}{
+				"token":      token,
+				"expires_at": expiresAt,
+			},
+		})
+	})
+
+	authGroup.POST("/logout", func(c echo.Context) error {
+		if err := controller.Logout(bearerToken(c)); err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Message: "logged out",
+		})
+	})
+
+	authGroup.GET("/me", func(c echo.Context) error {
+		current := currentUser(c)
+		return server.Response(c, Options{
+			Data: user.DTOUser{ID: current.ID, Email: current.Email},
+		})
+	})
 
 	// ***
 	// USER
 
 	userGroup.GET("/list", func(c echo.Context) error {
-		users, err := controller.Repo.ListUser()
+		query, err := userListQuery(c)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "cann't finde users",
-			})
+			return server.Error(c, err)
+		}
+
+		users, next, err := controller.Repo.ListUser(query)
+		if err != nil {
+			return server.Error(c, listError(err))
 		}
 		return server.Response(c, Options{
-			Data: users,
+			Data: listData(users, next),
 		})
 	})
 
 	userGroup.POST("/add", func(c echo.Context) error {
-		newUser := new(user.User)
+		newUser := new(user.DTONewUser)
 		if err := c.Bind(newUser); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "data reading error",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
 		}
 
-		id, err := controller.CreateUser(newUser.Email)
+		id, err := controller.CreateUser(currentUser(c), *newUser)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "data recording error",
-			})
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -93,20 +266,14 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	})
 
 	userGroup.POST("/batch", func(c echo.Context) error {
-		var users []user.User
+		var users []user.DTONewUser
 		if err := c.Bind(&users); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "invalid JSON payload",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		err := controller.CreateUsers(users)
+		err := controller.CreateUsers(currentUser(c), users)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "Failed to insert users",
-			})
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -116,22 +283,14 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	})
 
 	userGroup.DELETE("/delete", func(c echo.Context) (err error) {
-		idParam := c.QueryParam("id")
-		idInt, err := strconv.ParseUint(idParam, 10, 32)
+		id, err := parseID(c.QueryParam("id"))
 		if err != nil {
-			c.Logger().Error("Parse error:", err)
-			return server.Response(c, Options{
-				Message: "invalid ID",
-			})
+			return server.Error(c, err)
 		}
-		id := uint(idInt)
 
-		err = controller.DeleteUser(id)
+		err = controller.DeleteUser(currentUser(c), id)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "user not found",
-			})
+			return server.Error(c, apperr.From(err, "user not found"))
 		}
 
 		return server.Response(c, Options{
@@ -143,33 +302,29 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	// PROJECT
 
 	projectGroup.GET("/list", func(c echo.Context) error {
-		projects, err := controller.Repo.ListProject()
+		query, err := projectListQuery(c)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "cann't finde projects",
-			})
+			return server.Error(c, err)
+		}
+
+		projects, next, err := controller.Repo.ListProject(query)
+		if err != nil {
+			return server.Error(c, listError(err))
 		}
 		return server.Response(c, Options{
-			Data: projects,
+			Data: listData(projects, next),
 		})
 	})
 
 	projectGroup.POST("/add", func(c echo.Context) error {
 		newProject := new(project.Project)
 		if err := c.Bind(newProject); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "data reading error",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
 		}
 
-		id, err := controller.CreateProject(newProject.Name, newProject.Blocked)
+		id, err := controller.CreateProject(currentUser(c), newProject.Name, newProject.Blocked)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "data recording error",
-			})
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -180,18 +335,12 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	projectGroup.POST("/batch", func(c echo.Context) error {
 		var projects []project.Project
 		if err := c.Bind(&projects); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "invalid JSON payload",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		err := controller.CreateProjects(projects)
+		err := controller.CreateProjects(currentUser(c), projects)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "Failed to insert projects",
-			})
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -201,22 +350,14 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	})
 
 	projectGroup.DELETE("/delete", func(c echo.Context) (err error) {
-		idParam := c.QueryParam("id")
-		idInt, err := strconv.ParseUint(idParam, 10, 32)
+		id, err := parseID(c.QueryParam("id"))
 		if err != nil {
-			c.Logger().Error("Parse error:", err)
-			return server.Response(c, Options{
-				Message: "invalid ID",
-			})
+			return server.Error(c, err)
 		}
-		id := uint(idInt)
 
-		err = controller.DeleteProject(id)
+		err = controller.DeleteProject(currentUser(c), id)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "project not found",
-			})
+			return server.Error(c, apperr.From(err, "project not found"))
 		}
 
 		return server.Response(c, Options{
@@ -224,69 +365,333 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 		})
 	})
 
+	projectGroup.GET("/:id/members", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		members, err := controller.ListMembers(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: members,
+		})
+	})
+
+	projectGroup.POST("/:id/members", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		dto := new(project.DTOMember)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
+		}
+
+		member, err := controller.SaveMember(currentUser(c), id, *dto)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: member,
+		})
+	})
+
+	projectGroup.DELETE("/:id/members", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+		userID, err := parseID(c.QueryParam("user_id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		err = controller.RemoveMember(currentUser(c), id, userID)
+		if err != nil {
+			return server.Error(c, apperr.From(err, "member not found"))
+		}
+
+		return server.Response(c, Options{
+			Message: "member was removed",
+		})
+	})
+
+	projectGroup.GET("/:id/statuses", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		statuses, err := controller.ProjectStatuses(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: statuses,
+		})
+	})
+
+	projectGroup.POST("/:id/statuses", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		dto := new(workflow.DTOStatus)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
+		}
+
+		status, err := controller.AddProjectStatus(currentUser(c), id, *dto)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: status,
+		})
+	})
+
+	projectGroup.DELETE("/:id/statuses", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		err = controller.RemoveProjectStatus(currentUser(c), id, c.QueryParam("name"))
+		if err != nil {
+			return server.Error(c, apperr.From(err, "status not found"))
+		}
+
+		return server.Response(c, Options{
+			Message: "status was removed",
+		})
+	})
+
+	projectGroup.POST("/:id/block", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		diffID, err := controller.SetProjectBlocked(currentUser(c), id, true)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Message: "project was blocked",
+			Data:    map[string]interface{}{"id": diffID},
+		})
+	})
+
+	projectGroup.POST("/:id/unblock", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		diffID, err := controller.SetProjectBlocked(currentUser(c), id, false)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Message: "project was unblocked",
+			Data:    map[string]interface{}{"id": diffID},
+		})
+	})
+
+	projectGroup.GET("/:id/history", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		history, err := controller.ProjectHistory(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: history,
+		})
+	})
+
 	// ***
 	// ISSUE
 
 	issueGroup.GET("/list", func(c echo.Context) error {
-		issues, err := controller.Repo.ListIssue()
+		query, err := issueListQuery(c)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "cann't finde issues",
-			})
+			return server.Error(c, err)
+		}
+
+		requested, _ := query.Filters["project_id"].([]string)
+		scope, err := controller.ScopeProjects(currentUser(c), requested)
+		if err != nil {
+			return server.Error(c, err)
+		}
+		if scope != nil {
+			query.Filters["project_id"] = scope
+		}
+
+		issues, next, err := controller.Repo.ListIssue(query)
+		if err != nil {
+			return server.Error(c, listError(err))
 		}
 		return server.Response(c, Options{
-			Data: issues,
+			Data: listData(issues, next),
 		})
 	})
 
-	issueGroup.POST("/add", func(c echo.Context) error {
-		dto := new(issue.DTOissue)
+	issueGroup.GET("/:id", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		foundIssue, err := controller.GetIssue(currentUser(c), id, project.RoleViewer)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		c.Response().Header().Set("ETag", etag(foundIssue.Version))
+		return server.Response(c, Options{
+			Data: foundIssue,
+		})
+	})
+
+	issueGroup.GET("/:id/history", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		history, err := controller.IssueHistory(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, apperr.From(err, "issue not found"))
+		}
+
+		return server.Response(c, Options{
+			Data: history,
+		})
+	})
+
+	issueGroup.GET("/:id/timeline", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		timeline, err := controller.IssueTimeline(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: timeline,
+		})
+	})
+
+	issueGroup.GET("/:id/comments", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		comments, err := controller.ListComments(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: comments,
+		})
+	})
+
+	issueGroup.POST("/:id/comments", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		dto := new(comment.DTOComment)
 		if err := c.Bind(dto); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "data reading error",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		deadline, err := time.Parse("02-01-2006", dto.Deadline)
+		created, err := controller.AddComment(currentUser(c), id, *dto)
 		if err != nil {
-			c.Logger().Error("Parse error:", err)
-			return server.Response(c, Options{
-				Message: "invalid deadline format",
-			})
+			return server.Error(c, err)
 		}
 
-		newProject, err := controller.Repo.GetProject(dto.ProjectID)
+		return server.Response(c, Options{
+			Data: created,
+		})
+	})
+
+	issueGroup.PATCH("/:id/comments/:comment_id", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "project search error",
-			})
+			return server.Error(c, err)
+		}
+		commentID, err := parseID(c.Param("comment_id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		dto := new(comment.DTOComment)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		newUser, err := controller.Repo.GetUser(dto.UserID)
+		updated, err := controller.EditComment(currentUser(c), id, commentID, *dto)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "user search error",
-			})
+			return server.Error(c, err)
 		}
 
-		users, err := controller.Repo.UsersByID(dto.Watchers)
+		return server.Response(c, Options{
+			Data: updated,
+		})
+	})
+
+	issueGroup.DELETE("/:id/comments/:comment_id", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "users search error",
-			})
+			return server.Error(c, err)
+		}
+		commentID, err := parseID(c.Param("comment_id"))
+		if err != nil {
+			return server.Error(c, err)
 		}
 
-		id, err := controller.CreateIssue(dto.Title, *newUser, *newProject, dto.Priority, dto.Status, deadline, users)
+		err = controller.DeleteComment(currentUser(c), id, commentID)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "data recording error",
-			})
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Message: "comment was deleted",
+		})
+	})
+
+	issueGroup.POST("/add", func(c echo.Context) error {
+		dto := new(issue.DTOissue)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "data reading error").Wrap(err))
+		}
+
+		id, err := controller.CreateIssue(currentUser(c), *dto)
+		if err != nil {
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -297,41 +702,17 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	issueGroup.POST("/batch", func(c echo.Context) error {
 		var payloads []issue.DTOissue
 		if err := c.Bind(&payloads); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "invalid JSON payload",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		var issues []issue.Issue
-		for _, p := range payloads {
-			users, _ := controller.Repo.UsersByID(p.Watchers)
-			deadline, _ := time.Parse("02-01-2006", p.Deadline)
-
-			issues = append(issues, issue.Issue{
-				Title:     p.Title,
-				UserID:    p.UserID,
-				ProjectID: p.ProjectID,
-				Priority:  p.Priority,
-				Status:    p.Status,
-				Deadline:  deadline,
-				Watchers:  users,
-			})
+		issues, err := controller.ValidateIssues(payloads, true)
+		if err != nil {
+			return server.Error(c, err)
 		}
 
-		for i := 0; i < len(issues); i += batchSize {
-			end := i + batchSize
-			if end > len(issues) {
-				end = len(issues)
-			}
-
-			err := controller.CreateIssues(issues[i:end])
-			if err != nil {
-				c.Logger().Error("Insert error:", err)
-				return server.Response(c, Options{
-					Message: "Failed to insert issues",
-				})
-			}
+		err = controller.CreateIssues(currentUser(c), issues, server.BatchSize)
+		if err != nil {
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -341,71 +722,41 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 	})
 
 	issueGroup.PATCH("/update", func(c echo.Context) (err error) {
-		idParam := c.QueryParam("id")
-		idInt, err := strconv.ParseUint(idParam, 10, 32)
+		id, err := parseID(c.QueryParam("id"))
 		if err != nil {
-			c.Logger().Error("Parse error:", err)
-			return server.Response(c, Options{
-				Message: "invalid ID",
-			})
-		}
-		id := uint(idInt)
-
-		var jsonBody map[string]interface{}
-		if err := c.Bind(&jsonBody); err != nil {
-			c.Logger().Error("Bind error:", err)
-			return server.Response(c, Options{
-				Message: "invalid JSON payload",
-			})
+			return server.Error(c, err)
 		}
 
-		oldIssue, err := controller.Repo.GetIssue(id)
+		version, err := parseIfMatch(c.Request().Header.Get("If-Match"))
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "issue search error",
-			})
+			return server.Error(c, err)
 		}
 
-		updatedIssue := *oldIssue
-		err = controller.Repo.UpdateIssue(&updatedIssue, jsonBody)
-		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "issue update error",
-			})
+		dto := new(issue.DTOPatch)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
 		}
 
-		diffID, err := controller.CreateDiff(id, jsonBody, oldIssue)
+		diffID, version, err := controller.UpdateIssue(currentUser(c), id, version, *dto)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "data recording error",
-			})
+			return server.Error(c, err)
 		}
 
+		c.Response().Header().Set("ETag", etag(version))
 		return server.Response(c, Options{
 			Data: map[string]interface{}{"id": diffID},
 		})
 	})
 
 	issueGroup.DELETE("/delete", func(c echo.Context) (err error) {
-		idParam := c.QueryParam("id")
-		idInt, err := strconv.ParseUint(idParam, 10, 32)
+		id, err := parseID(c.QueryParam("id"))
 		if err != nil {
-			c.Logger().Error("Parse error:", err)
-			return server.Response(c, Options{
-				Message: "invalid ID",
-			})
+			return server.Error(c, err)
 		}
-		id := uint(idInt)
 
-		err = controller.DeleteIssue(id)
+		err = controller.DeleteIssue(currentUser(c), id)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "issue not found",
-			})
+			return server.Error(c, apperr.From(err, "issue not found"))
 		}
 
 		return server.Response(c, Options{
@@ -413,29 +764,41 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 		})
 	})
 
+	if server.MetricsToken != "" {
+		e.GET("/metrics", server.MetricsHandler())
+	}
+
+	e.GET("/healthz", func(c echo.Context) error {
+		return server.Health(c, controller.Liveness())
+	})
+
+	e.GET("/readyz", func(c echo.Context) error {
+		return server.Health(c, controller.Readiness(c.Request().Context()))
+	})
+
 	e.GET("/stat", func(c echo.Context) error {
+		excludeBlocked := false
+		if value := c.QueryParam("exclude_blocked"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return server.Error(c, invalidParam("exclude_blocked", "must be true or false"))
+			}
+			excludeBlocked = parsed
+		}
+
 		userCount, err := controller.Repo.CountUsers()
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "row counting error for user",
-			})
+			return server.Error(c, err)
 		}
 
-		projectCount, err := controller.Repo.CountProjects()
+		projectCount, err := controller.Repo.CountProjects(excludeBlocked)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "row counting error for project",
-			})
+			return server.Error(c, err)
 		}
 
-		issueCount, err := controller.Repo.CountIssues()
+		issueCount, err := controller.Repo.CountIssues(excludeBlocked)
 		if err != nil {
-			c.Logger().Error("SQL error:", err)
-			return server.Response(c, Options{
-				Message: "row counting error for issue",
-			})
+			return server.Error(c, err)
 		}
 
 		return server.Response(c, Options{
@@ -451,48 +814,112 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 		ctx := context.Background()
 		var req ChartsRequest
 		var fields interface{}
-		filters := map[string]string{}
+		filters := map[string][]string{}
 
 		if err := c.Bind(&req); err != nil {
-			c.Logger().Error("Bind groupby error:", err)
-			return server.Response(c, Options{
-				Message: "invalid JSON payload",
-			})
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
+		}
+
+		if !slices.Contains(chartGroups, req.GroupBy) {
+			return server.Error(c, apperr.NewValidation("invalid_parameter", "unknown groupBy", apperr.FieldError{
+				Field:   "groupBy",
+				Message: "must be one of user, project, priority, status",
+			}))
 		}
 
 		if len(req.Filters) != 0 {
-			for _,item := range req.Filters {
-				filters[item.FilterType] = item.Value
+			var fieldErrors []apperr.FieldError
+			for i, item := range req.Filters {
+				if !slices.Contains(chartFilters, item.FilterType) {
+					fieldErrors = append(fieldErrors, apperr.FieldError{
+						Field:   "filters[" + strconv.Itoa(i) + "].type",
+						Message: "unknown filter type: " + item.FilterType,
+					})
+					continue
+				}
+				filters[item.FilterType] = append(filters[item.FilterType], item.Value)
+			}
+			if len(fieldErrors) > 0 {
+				return server.Error(c, apperr.NewValidation("invalid_parameter", "unknown filter type", fieldErrors...))
 			}
 		}
 
+		scope, err := controller.ScopeProjects(currentUser(c), filters["project_id"])
+		if err != nil {
+			return server.Error(c, err)
+		}
+		if req.ExcludeBlocked {
+			scope, err = controller.ExcludeBlocked(scope)
+			if err != nil {
+				return server.Error(c, err)
+			}
+		}
+		if scope != nil {
+			filters["project_id"] = scope
+		}
+
+		var dates, keyDates []time.Time
+		if req.ChartType == "line" {
+			var live bool
+			dates, live, err = lineDates(req)
+			if err != nil {
+				return server.Error(c, err)
+			}
+			// The current state, the last point of an open-ended chart,
+			// only changes with the issues, which the tags track.
+			keyDates = dates
+			if live {
+				keyDates = dates[:len(dates)-1]
+			}
+		}
+
+		// Results are cached under keys that change whenever the issues in
+		// scope change, see Controller.ChartCacheKey.
+		cacheKey, err := controller.ChartCacheKey(ctx, req, keyDates, scope)
+		if err != nil {
+			c.Logger().Error("Cache key error:", err)
+		} else if cached, err := controller.Redis.Get(ctx, cacheKey); err == nil {
+			server.Metrics.ChartCache.WithLabelValues("hit").Inc()
+			c.Logger().Info("Cache hit for key:", cacheKey)
+			return server.Response(c, Options{
+				Data: json.RawMessage(cached),
+			})
+		}
+		server.Metrics.ChartCache.WithLabelValues("miss").Inc()
+		respond := func(data map[string]interface{}) error {
+			if cacheKey != "" {
+				if dataJSON, err := json.Marshal(data); err == nil {
+					_ = controller.Redis.Set(ctx, cacheKey, string(dataJSON))
+				}
+			}
+			return server.Response(c, Options{
+				Data: data,
+			})
+		}
+
 		for req.ChartType == "bar" || req.ChartType == "" {
-			result, err := controller.Repo.CountIssuesGroup(req.GroupBy, filters)
+			barFilters := map[string]interface{}{}
+			for column, values := range filters {
+				barFilters[column] = values
+			}
+
+			result, err := controller.Repo.CountIssuesGroup(req.GroupBy, barFilters)
 			if err != nil {
-				c.Logger().Error("SQL error:", err)
-				return server.Response(c, Options{
-					Message: "row counting error for issue",
-					})
+				return server.Error(c, err)
 			}
 
 			switch req.GroupBy {
 			case "user":
-				users, err := controller.Repo.ListUser()
+				users, err := controller.Repo.UserFields(resultIDs(result))
 				if err != nil {
-					c.Logger().Error("SQL error:", err)
-					return server.Response(c, Options{
-						Message: "can't found users",
-						})
+					return server.Error(c, err)
 				}
 				fields = users
 
 			case "project":
-				projects, err := controller.Repo.ListProject()
+				projects, err := controller.Repo.ProjectFields(resultIDs(result))
 				if err != nil {
-					c.Logger().Error("SQL error:", err)
-					return server.Response(c, Options{
-						Message: "can't found projects",
-						})
+					return server.Error(c, err)
 				}
 				fields = projects
 
@@ -503,67 +930,32 @@ func (server HttpServer) HandleHttp(controller *controller.Controller) {
 				fields = nil
 			}
 
-			return server.Response(c, Options{
-				Data: map[string]interface{}{
-					"groupBy": req.GroupBy,
-					"result":  result,
-					"fields":  fields,
-					},
-					})
+			return respond(map[string]interface{}{
+				"groupBy": req.GroupBy,
+				"result":  result,
+				"fields":  fields,
+			})
 		}
 
 		for req.ChartType == "line" {
-			jsonData, err := json.Marshal(req)
+			start := time.Now()
+			result, err := controller.LineIssues(dates, req.GroupBy, filters)
+			server.Metrics.LineIssues.Observe(time.Since(start).Seconds())
 			if err != nil {
-				c.Logger().Error("JSON serialization error:", err)
-				return server.Response(c, Options{
-					Message: "cannot get string to generate CacheKey",
-				})
-			}
-			cacheKey := helpers.GenerateCacheKey(jsonData)
-			cachedData, err := controller.Redis.Get(ctx, cacheKey)
-			cachedResult := map[time.Time]map[string]int{}
-			if err == nil {
-				err = json.Unmarshal([]byte(cachedData), &cachedResult)
-				if err != nil {
-        			c.Logger().Error("Cache JSON decode error:", err)
-        			return server.Response(c, Options{
-            			Message: "error decoding cached data",
-        			})
-    			}
-				c.Logger().Info("Cache hit for key:", cacheKey)
-				return server.Response(c, Options{
-					Data: map[string]interface{}{
-					"groupBy": req.GroupBy,
-					"result":  cachedResult,
-					},
-				})
+				return server.Error(c, err)
 			}
 
-			result, err := controller.LineIssues()
-			if err != nil {
-				c.Logger().Error("SQL error:", err)
-				return server.Response(c, Options{
-					Message: "row counting error for issue",
-				})
-			}
-			resultJSON, err := json.Marshal(result)
-			if err == nil {
-				_ = controller.Redis.Set(ctx, cacheKey, string(resultJSON))
-			}
-
-			return server.Response(c, Options{
-				Data: map[string]interface{}{
-					"groupBy": req.GroupBy,
-					"result":  result,
-					},
-				})
+			return respond(map[string]interface{}{
+				"groupBy": req.GroupBy,
+				"result":  result,
+			})
 		}
 
-		return server.Response(c, Options{
-			Message: "Unknown request",
-		})
+		return server.Error(c, apperr.NewValidation("invalid_parameter", "unknown chart type", apperr.FieldError{
+			Field:   "chartType",
+			Message: "must be bar or line",
+		}))
 	})
 
-	e.Logger.Fatal(e.Start(":1323"))
+	return e
 }
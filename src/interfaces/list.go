@@ -0,0 +1,144 @@
+package interfaces
+
+import (
+	"charts/apperr"
+	"charts/helpers"
+	"charts/infra"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+)
+
+func listQuery(c echo.Context) (infra.ListQuery, error) {
+	query := infra.ListQuery{
+		Cursor:  c.QueryParam("cursor"),
+		Sort:    c.QueryParam("sort"),
+		Filters: map[string]interface{}{},
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return query, invalidParam("limit", "must be a positive number")
+		}
+		query.Limit = value
+	}
+
+	return query, nil
+}
+
+// queryValues collects a repeated or comma-separated query parameter.
+func queryValues(c echo.Context, name string) []string {
+	var values []string
+	for _, param := range c.QueryParams()[name] {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func issueListQuery(c echo.Context) (infra.ListQuery, error) {
+	query, err := listQuery(c)
+	if err != nil {
+		return query, err
+	}
+
+	for _, name := range []string{"status", "priority", "project_id", "user_id"} {
+		if values := queryValues(c, name); len(values) > 0 {
+			query.Filters[name] = values
+		}
+	}
+
+	if value := c.QueryParam("deadline_from"); value != "" {
+		date, err := helpers.ParseDate(value)
+		if err != nil {
+			return query, invalidParam("deadline_from", err.Error())
+		}
+		query.Conditions = append(query.Conditions, infra.Condition{Query: "deadline >= ?", Args: []interface{}{date}})
+	}
+	if value := c.QueryParam("deadline_to"); value != "" {
+		date, err := helpers.ParseDate(value)
+		if err != nil {
+			return query, invalidParam("deadline_to", err.Error())
+		}
+		query.Conditions = append(query.Conditions, infra.Condition{Query: "deadline <= ?", Args: []interface{}{date}})
+	}
+
+	return query, nil
+}
+
+func userListQuery(c echo.Context) (infra.ListQuery, error) {
+	query, err := listQuery(c)
+	if err != nil {
+		return query, err
+	}
+
+	if email := c.QueryParam("email"); email != "" {
+		query.Conditions = append(query.Conditions, infra.Condition{Query: "email LIKE ?", Args: []interface{}{"%" + email + "%"}})
+	}
+
+	return query, nil
+}
+
+func projectListQuery(c echo.Context) (infra.ListQuery, error) {
+	query, err := listQuery(c)
+	if err != nil {
+		return query, err
+	}
+
+	if name := c.QueryParam("name"); name != "" {
+		query.Conditions = append(query.Conditions, infra.Condition{Query: "name LIKE ?", Args: []interface{}{"%" + name + "%"}})
+	}
+	if blocked := c.QueryParam("blocked"); blocked != "" {
+		value, err := strconv.ParseBool(blocked)
+		if err != nil {
+			return query, invalidParam("blocked", "must be true or false")
+		}
+		query.Filters["blocked"] = value
+	}
+
+	return query, nil
+}
+
+func listData(items interface{}, next string) map[string]interface{} {
+	var nextCursor interface{}
+	if next != "" {
+		nextCursor = next
+	}
+	return map[string]interface{}{
+		"items":       items,
+		"next_cursor": nextCursor,
+	}
+}
+
+// resultIDs returns the user or project IDs that appear as chart groups.
+func resultIDs(result map[string]int) []uint {
+	ids := make([]uint, 0, len(result))
+	for key := range result {
+		if id, err := strconv.ParseUint(key, 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+func invalidParam(field string, message string) *apperr.Error {
+	return apperr.NewValidation("invalid_parameter", "invalid list parameters", apperr.FieldError{
+		Field:   field,
+		Message: message,
+	})
+}
+
+func listError(err error) *apperr.Error {
+	switch {
+	case errors.Is(err, infra.ErrInvalidCursor):
+		return invalidParam("cursor", "is not a cursor returned for this sort order")
+	case errors.Is(err, infra.ErrInvalidSort):
+		return invalidParam("sort", "unknown sort field")
+	}
+	return apperr.From(err, "record not found")
+}
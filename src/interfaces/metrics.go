@@ -0,0 +1,52 @@
+package interfaces
+
+import (
+	"charts/apperr"
+	"crypto/subtle"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Instrument observes the duration of every request, labelled with the
+// route template rather than the URL to keep the number of series bounded.
+func (server HttpServer) Instrument() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				status = http.StatusInternalServerError
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			server.Metrics.HTTPRequests.
+				WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// MetricsHandler serves the registry in the Prometheus text format to
+// scrapers that send MetricsToken.
+func (server HttpServer) MetricsHandler() echo.HandlerFunc {
+	handler := echo.WrapHandler(promhttp.HandlerFor(server.Metrics.Registry, promhttp.HandlerOpts{}))
+	return func(c echo.Context) error {
+		if subtle.ConstantTimeCompare([]byte(bearerToken(c)), []byte(server.MetricsToken)) != 1 {
+			return server.Error(c, apperr.NewUnauthorized("invalid_token", "invalid metrics token"))
+		}
+		return handler(c)
+	}
+}
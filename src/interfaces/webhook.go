@@ -0,0 +1,94 @@
+package interfaces
+
+import (
+	"charts/apperr"
+	"charts/controller"
+	"charts/domain/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+func (server HttpServer) webhookRoutes(webhookGroup *echo.Group, controller *controller.Controller) {
+	webhookGroup.GET("/list", func(c echo.Context) error {
+		var projectID *uint
+		if value := c.QueryParam("project_id"); value != "" {
+			id, err := parseID(value)
+			if err != nil {
+				return server.Error(c, err)
+			}
+			projectID = &id
+		}
+
+		subscriptions, err := controller.ListSubscriptions(currentUser(c), projectID)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: subscriptions,
+		})
+	})
+
+	webhookGroup.POST("/add", func(c echo.Context) error {
+		dto := new(webhook.DTOSubscription)
+		if err := c.Bind(dto); err != nil {
+			return server.Error(c, apperr.NewValidation("invalid_body", "invalid JSON payload").Wrap(err))
+		}
+
+		subscription, err := controller.AddSubscription(currentUser(c), *dto)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: subscription,
+		})
+	})
+
+	webhookGroup.DELETE("/delete", func(c echo.Context) error {
+		id, err := parseID(c.QueryParam("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		err = controller.DeleteSubscription(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, apperr.From(err, "webhook not found"))
+		}
+
+		return server.Response(c, Options{
+			Message: "webhook was deleted",
+		})
+	})
+
+	webhookGroup.GET("/:id/deliveries", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		deliveries, err := controller.ListDeliveries(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: deliveries,
+		})
+	})
+
+	webhookGroup.POST("/deliveries/:id/redeliver", func(c echo.Context) error {
+		id, err := parseID(c.Param("id"))
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		delivery, err := controller.Redeliver(currentUser(c), id)
+		if err != nil {
+			return server.Error(c, err)
+		}
+
+		return server.Response(c, Options{
+			Data: delivery,
+		})
+	})
+}
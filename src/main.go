@@ -1,20 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"charts/config"
 	"charts/controller"
 	"charts/domain"
-	"charts/domain/diff"
-	"charts/domain/issue"
-	"charts/domain/project"
-	"charts/domain/user"
+	"charts/domain/notification"
 	"charts/infra"
 	"charts/interfaces"
+	"charts/migrations"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 type App struct {
@@ -24,42 +32,262 @@ type App struct {
 }
 
 func main() {
-	dsn := "root:secret@tcp(sql_charts:3306)/charts?parseTime=true&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := gorm.Open(mysql.Open(cfg.Database.DSN()), &gorm.Config{})
 	if err != nil {
         log.Fatal(err)
     }
-	err = (*db).AutoMigrate(&issue.Issue{}, &user.User{}, &project.Project{}, &diff.CommentsDiff{})
+	migrator, err := migrations.New(db)
 	if err != nil {
-		fmt.Println(err)
+		log.Fatal(err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(migrator, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := migrator.Check(); errors.Is(err, migrations.ErrPending) {
+		log.Print(err)
+	} else if err != nil {
+		log.Fatal(err)
 	}
 
 	ctx := context.Background()
 	rdb := redis.NewClient(&redis.Options{
-		Addr: "redis:6379",
-		DB:   0,
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
 	_, err = rdb.Ping(ctx).Result()
 	if err != nil {
 		log.Fatalf("Error connecting to Redis: %v", err)
 	}
 
+	repo := &infra.Repository{DB: db}
+	metrics := infra.NewMetrics()
+	if err := db.Use(metrics); err != nil {
+		log.Fatal(err)
+	}
+
 	app := &App{
 		Domain: &domain.Domain{},
 		Infra: &infra.Infra{
-			Repository: &infra.Repository{
-				DB: db,
-			},
+			Repository: repo,
 			Redis: &infra.RedisRepository{
 				Client: rdb,
+				TTL: cfg.Cache.ChartTTL,
 			},
 		},
-		Interfaces: &interfaces.HttpServer{},
+		Interfaces: &interfaces.HttpServer{
+			Addr: cfg.Listen,
+			CORSOrigins: cfg.CORS.Origins,
+			BatchSize: cfg.BatchSize,
+			Metrics: metrics,
+			MetricsToken: cfg.Metrics.Token,
+		},
 	}
 
-	app.Interfaces.HandleHttp(&controller.Controller{
+	ctrl := &controller.Controller{
 		Repo: app.Infra.Repository,
 		Domain: app.Domain,
 		Redis: app.Infra.Redis,
+		Workflow: controller.NewWorkflow(app.Domain),
+		Notifiers: notifiers(cfg.Notify),
+		Migrator: migrator,
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill-snapshots" {
+		days, err := ctrl.BackfillSnapshots()
+		if err != nil {
+			log.Fatalf("Error backfilling snapshots: %v", err)
+		}
+		log.Printf("Backfilled snapshots for %d days", days)
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "promote-admin" {
+		if err := ctrl.PromoteAdmin(os.Args[2]); err != nil {
+			log.Fatalf("Error promoting admin: %v", err)
+		}
+		log.Printf("%s is now a global admin", os.Args[2])
+		return
+	}
+
+	// The password is read from the first line of stdin, so it stays out of
+	// the process list and the shell history.
+	if len(os.Args) > 2 && os.Args[1] == "set-password" {
+		input := bufio.NewScanner(os.Stdin)
+		input.Scan()
+		if err := input.Err(); err != nil {
+			log.Fatalf("Error reading password: %v", err)
+		}
+		if err := ctrl.SetPassword(os.Args[2], input.Text()); err != nil {
+			log.Fatalf("Error setting password: %v", err)
+		}
+		log.Printf("Password of %s was set", os.Args[2])
+		return
+	}
+
+	workers := &infra.Workers{}
+	ctrl.Workers = workers
+	workers.Start("snapshots", &infra.SnapshotJob{
+		Repo: app.Infra.Repository,
+		Every: time.Minute,
+	})
+
+	workers.Start("webhooks", &infra.WebhookWorker{
+		Repo: app.Infra.Repository,
+		Client: infra.NewWebhookClient(10 * time.Second),
+		Every: 5 * time.Second,
+		BatchSize: 100,
+		MaxAttempts: 8,
+	})
+	workers.Start("notifications", &infra.NotificationWorker{
+		Repo: app.Infra.Repository,
+		Channels: ctrl.Notifiers,
+		Every: 5 * time.Second,
+		BatchSize: 100,
+		MaxAttempts: 8,
+		Timeout: controller.NotifyTimeout,
+	})
+	workers.Start("outbox", &infra.Dispatcher{
+		Repo: app.Infra.Repository,
+		Consumers: ctrl.Consumers(),
+		Every: time.Second,
+		BatchSize: 100,
+		Retention: 7 * 24 * time.Hour,
+		MaxAttempts: 10,
+		Lease: time.Minute,
+		Settle: 30 * time.Second,
+	})
+	workers.Start("metrics", &infra.CountsWorker{
+		Repo: app.Infra.Repository,
+		Metrics: metrics,
+		Every: 30 * time.Second,
 	})
+
+	e := app.Interfaces.HandleHttp(ctrl)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- e.Start(app.Interfaces.Addr)
+	}()
+
+	// A server that failed to start or stopped by itself exits non-zero, so
+	// orchestrators do not take it for a clean stop.
+	var failed error
+	signals, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-signals.Done():
+		log.Printf("Shutting down, waiting up to %s", cfg.ShutdownTimeout)
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			failed = err
+			log.Printf("HTTP server stopped: %v", err)
+		}
+	}
+	stop()
+
+	if err := shutdown(cfg.ShutdownTimeout, e, workers, rdb, db); err != nil {
+		log.Fatalf("Error shutting down: %v", err)
+	}
+	if failed != nil {
+		os.Exit(1)
+	}
+}
+
+// shutdown stops accepting requests and drains the in-flight ones, then
+// stops the background workers and finally closes Redis and the database,
+// all within timeout. Connections are closed even when draining times out.
+func shutdown(timeout time.Duration, e *echo.Echo, workers *infra.Workers, rdb *redis.Client, db *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := e.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server: %w", err))
+	}
+	if err := workers.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("workers: %w", err))
+	}
+	if err := rdb.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("redis: %w", err))
+	}
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("database: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// notifiers returns the notification channels: email when an SMTP address
+// is configured and a webhook when a webhook URL is configured.
+func notifiers(cfg config.Notify) map[string]infra.Notifier {
+	channels := map[string]infra.Notifier{}
+	if cfg.SMTPAddr != "" {
+		channels[notification.ChannelEmail] = &infra.SMTPNotifier{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	}
+	if cfg.WebhookURL != "" {
+		channels[notification.ChannelWebhook] = &infra.WebhookNotifier{
+			URL:    cfg.WebhookURL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return channels
+}
+
+// migrate runs the migrate subcommand: "up [version]", "down [steps]" or
+// "status".
+func migrate(migrator *migrations.Migrator, args []string) error {
+	usage := errors.New("usage: migrate up [version] | migrate down [steps] | migrate status")
+	if len(args) == 0 || len(args) > 2 {
+		return usage
+	}
+	number := 0
+	if len(args) == 2 {
+		value, err := strconv.Atoi(args[1])
+		if err != nil || value < 1 {
+			return usage
+		}
+		number = value
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(number)
+		for _, migration := range applied {
+			log.Printf("Applied %d_%s", migration.Version, migration.Name)
+		}
+		return err
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		reverted, err := migrator.Down(number)
+		for _, migration := range reverted {
+			log.Printf("Reverted %d_%s", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		current, dirty, err := migrator.Current()
+		if err != nil {
+			return err
+		}
+		log.Printf("Schema version %d (dirty: %t), latest %d", current, dirty, migrator.Latest())
+		return nil
+	}
+	return usage
 }
@@ -0,0 +1,259 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrPending is wrapped by Check when the schema is behind this build, the
+// only state the server starts in: it reports not ready until the
+// migrations are applied.
+var ErrPending = errors.New("migrations are pending")
+
+// Migration is one schema change with the scripts to apply and revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration. A dirty migration was
+// started but did not finish, and the schema must be repaired by hand.
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:256"`
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		script, err := fs.ReadFile(files, "sql/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations: version %d has two names", version)
+		}
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs an up and a down script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// WithContext returns a migrator whose queries are bound to ctx.
+func (migrator *Migrator) WithContext(ctx context.Context) *Migrator {
+	return &Migrator{DB: migrator.DB.WithContext(ctx), Migrations: migrator.Migrations}
+}
+
+// Latest returns the version this build expects.
+func (migrator *Migrator) Latest() int {
+	if len(migrator.Migrations) == 0 {
+		return 0
+	}
+	return migrator.Migrations[len(migrator.Migrations)-1].Version
+}
+
+// Current returns the latest applied version and whether it is dirty.
+func (migrator *Migrator) Current() (int, bool, error) {
+	var last SchemaMigration
+	result := migrator.DB.Order("version DESC").Limit(1).Find(&last)
+	return last.Version, last.Dirty, result.Error
+}
+
+// Check refuses a schema that is dirty, older than this build or newer
+// than any migration it knows.
+func (migrator *Migrator) Check() error {
+	current, dirty, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+	latest := migrator.Latest()
+	switch {
+	case dirty:
+		return fmt.Errorf("migrations: version %d is dirty, repair the schema and the schema_migrations row by hand", current)
+	case current > latest:
+		return fmt.Errorf("migrations: unknown schema version %d, this build knows up to %d", current, latest)
+	case current < latest:
+		return fmt.Errorf("migrations: schema version %d is behind %d, run the migrate up command: %w", current, latest, ErrPending)
+	}
+	return nil
+}
+
+// Up applies the pending migrations up to the target version, or all of
+// them when target is 0, and returns the applied ones.
+func (migrator *Migrator) Up(target int) ([]Migration, error) {
+	if err := migrator.ensureClean(); err != nil {
+		return nil, err
+	}
+	current, _, err := migrator.Current()
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = migrator.Latest()
+	}
+
+	var applied []Migration
+	for _, migration := range migrator.Migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+		record := SchemaMigration{Version: migration.Version, Name: migration.Name, Dirty: true, AppliedAt: time.Now()}
+		if err := migrator.DB.Create(&record).Error; err != nil {
+			return applied, err
+		}
+		if err := migrator.exec(migration.Up); err != nil {
+			return applied, fmt.Errorf("migrations: %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		if err := migrator.DB.Model(&record).Update("dirty", false).Error; err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down reverts the given number of applied migrations, newest first, and
+// returns the reverted ones.
+func (migrator *Migrator) Down(steps int) ([]Migration, error) {
+	if err := migrator.ensureClean(); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(migrator.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrator.Migrations[i]
+		current, _, err := migrator.Current()
+		if err != nil {
+			return reverted, err
+		}
+		if migration.Version > current {
+			continue
+		}
+		if migration.Version < current {
+			return reverted, fmt.Errorf("migrations: applied version %d is unknown to this build", current)
+		}
+
+		if err := migrator.DB.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Update("dirty", true).Error; err != nil {
+			return reverted, err
+		}
+		if err := migrator.exec(migration.Down); err != nil {
+			return reverted, fmt.Errorf("migrations: %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		if err := migrator.DB.Delete(&SchemaMigration{}, migration.Version).Error; err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+func (migrator *Migrator) ensureClean() error {
+	current, dirty, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migrations: version %d is dirty, repair the schema and the schema_migrations row by hand", current)
+	}
+	return nil
+}
+
+// exec runs a script statement by statement on one connection, so that
+// session variables and prepared statements carry over. A statement ends
+// with a semicolon at the end of a line.
+func (migrator *Migrator) exec(script string) error {
+	return migrator.DB.Connection(func(conn *gorm.DB) error {
+		for _, statement := range statements(script) {
+			if err := conn.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func statements(script string) []string {
+	var result []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			result = append(result, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		result = append(result, rest)
+	}
+	return result
+}
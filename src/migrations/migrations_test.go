@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"comments only", "-- nothing\n\n  -- to do\n", nil},
+		{"one", "DROP TABLE a;\n", []string{"DROP TABLE a"}},
+		{"without final semicolon", "DROP TABLE a", []string{"DROP TABLE a"}},
+		{
+			"several",
+			"-- tables\nCREATE TABLE a (\n  id INT,\n  -- the name\n  name TEXT\n);\n\nDROP TABLE b;\n",
+			[]string{"CREATE TABLE a (\n  id INT,\n  name TEXT\n)", "DROP TABLE b"},
+		},
+		{
+			"semicolon inside a line",
+			"INSERT INTO a VALUES ('x;y');\nUPDATE a SET name = 'z';",
+			[]string{"INSERT INTO a VALUES ('x;y')", "UPDATE a SET name = 'z'"},
+		},
+		{"windows line endings", "DROP TABLE a;\r\nDROP TABLE b;\r\n", []string{"DROP TABLE a", "DROP TABLE b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := statements(test.script); !slices.Equal(got, test.want) {
+				t.Errorf("statements = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if len(statements(migration.Up)) == 0 || len(statements(migration.Down)) == 0 {
+			t.Errorf("migration %d_%s has an empty script", migration.Version, migration.Name)
+		}
+	}
+}
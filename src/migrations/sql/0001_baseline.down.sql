@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS comments_diffs;
+DROP TABLE IF EXISTS issue_watchers;
+DROP TABLE IF EXISTS issues;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,65 @@
+-- Schema of the four tables AutoMigrate created before versioned
+-- migrations. Tables are created only if missing, so a database set up by
+-- AutoMigrate adopts this version as it is and takes every later change
+-- from the migrations that follow.
+
+CREATE TABLE IF NOT EXISTS users (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	email varchar(256),
+	PRIMARY KEY (id),
+	INDEX idx_users_deleted_at (deleted_at)
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	name varchar(256),
+	blocked boolean DEFAULT false,
+	PRIMARY KEY (id),
+	INDEX idx_projects_deleted_at (deleted_at)
+);
+
+CREATE TABLE IF NOT EXISTS issues (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	title varchar(256),
+	user_id bigint unsigned,
+	project_id bigint unsigned,
+	priority bigint,
+	status VARCHAR(20),
+	deadline datetime(3) NULL,
+	PRIMARY KEY (id),
+	INDEX idx_issues_deleted_at (deleted_at),
+	CONSTRAINT fk_issues_user FOREIGN KEY (user_id) REFERENCES users (id),
+	CONSTRAINT fk_issues_project FOREIGN KEY (project_id) REFERENCES projects (id),
+	CONSTRAINT chk_issues_priority CHECK (priority IN (1,2,3,4,5)),
+	CONSTRAINT chk_issues_status CHECK (status IN ('open', 'in_progress', 'closed', 'canceled'))
+);
+
+CREATE TABLE IF NOT EXISTS issue_watchers (
+	issue_id bigint unsigned,
+	user_id bigint unsigned,
+	PRIMARY KEY (issue_id, user_id),
+	CONSTRAINT fk_issue_watchers_issue FOREIGN KEY (issue_id) REFERENCES issues (id),
+	CONSTRAINT fk_issue_watchers_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS comments_diffs (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	diff json,
+	issue_id bigint unsigned,
+	result json,
+	PRIMARY KEY (id),
+	INDEX idx_comments_diffs_deleted_at (deleted_at),
+	CONSTRAINT fk_comments_diffs_issue FOREIGN KEY (issue_id) REFERENCES issues (id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE snapshot_days;
+DROP TABLE issue_daily_snapshots;
@@ -0,0 +1,15 @@
+CREATE TABLE issue_daily_snapshots (
+	day date,
+	issue_id bigint unsigned,
+	status VARCHAR(20),
+	user_id bigint unsigned,
+	project_id bigint unsigned,
+	priority bigint,
+	PRIMARY KEY (day, issue_id)
+);
+
+CREATE TABLE snapshot_days (
+	day date,
+	created_at datetime(3) NULL,
+	PRIMARY KEY (day)
+);
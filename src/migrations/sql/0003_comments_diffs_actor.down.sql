@@ -0,0 +1,2 @@
+ALTER TABLE comments_diffs DROP FOREIGN KEY fk_comments_diffs_actor;
+ALTER TABLE comments_diffs DROP COLUMN actor_id;
@@ -0,0 +1,3 @@
+ALTER TABLE comments_diffs
+	ADD COLUMN actor_id bigint unsigned NULL,
+	ADD CONSTRAINT fk_comments_diffs_actor FOREIGN KEY (actor_id) REFERENCES users (id);
@@ -0,0 +1,2 @@
+DROP TABLE auth_tokens;
+ALTER TABLE users DROP COLUMN password_hash;
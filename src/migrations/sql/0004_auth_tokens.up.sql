@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN password_hash varchar(60);
+
+CREATE TABLE auth_tokens (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	user_id bigint unsigned,
+	hash varchar(64),
+	expires_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	INDEX idx_auth_tokens_deleted_at (deleted_at),
+	UNIQUE INDEX idx_auth_tokens_hash (hash),
+	CONSTRAINT fk_auth_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE project_members;
+ALTER TABLE users DROP COLUMN admin;
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN admin boolean DEFAULT false;
+
+CREATE TABLE project_members (
+	id bigint unsigned AUTO_INCREMENT,
+	project_id bigint unsigned,
+	user_id bigint unsigned,
+	role VARCHAR(20),
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	UNIQUE INDEX idx_project_member (project_id, user_id),
+	CONSTRAINT chk_project_members_role CHECK (role IN ('viewer', 'reporter', 'maintainer', 'admin'))
+);
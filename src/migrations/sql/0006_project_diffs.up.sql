@@ -0,0 +1,12 @@
+CREATE TABLE project_diffs (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	project_id bigint unsigned,
+	result json,
+	actor_id bigint unsigned,
+	PRIMARY KEY (id),
+	INDEX idx_project_diffs_deleted_at (deleted_at),
+	CONSTRAINT fk_project_diffs_actor FOREIGN KEY (actor_id) REFERENCES users (id)
+);
@@ -0,0 +1 @@
+ALTER TABLE issues ADD COLUMN version bigint unsigned NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP TABLE project_statuses;
+-- Fails while issues use custom statuses.
+ALTER TABLE issues ADD CONSTRAINT chk_issues_status CHECK (status IN ('open', 'in_progress', 'closed', 'canceled'));
@@ -0,0 +1,12 @@
+-- Issue statuses are checked by the workflow since projects may define
+-- custom ones.
+ALTER TABLE issues DROP CHECK chk_issues_status;
+
+CREATE TABLE project_statuses (
+	id bigint unsigned AUTO_INCREMENT,
+	project_id bigint unsigned,
+	name VARCHAR(20),
+	created_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	UNIQUE INDEX idx_project_status (project_id, name)
+);
@@ -0,0 +1 @@
+DROP TABLE issue_comments;
@@ -0,0 +1,16 @@
+CREATE TABLE issue_comments (
+	id bigint unsigned AUTO_INCREMENT,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	deleted_at datetime(3) NULL,
+	issue_id bigint unsigned,
+	parent_id bigint unsigned,
+	author_id bigint unsigned,
+	body TEXT,
+	PRIMARY KEY (id),
+	INDEX idx_issue_comments_deleted_at (deleted_at),
+	INDEX idx_issue_comments_issue_id (issue_id),
+	CONSTRAINT fk_issue_comments_issue FOREIGN KEY (issue_id) REFERENCES issues (id),
+	CONSTRAINT fk_issue_comments_parent FOREIGN KEY (parent_id) REFERENCES issue_comments (id),
+	CONSTRAINT fk_issue_comments_author FOREIGN KEY (author_id) REFERENCES users (id)
+);
@@ -0,0 +1,30 @@
+CREATE TABLE webhook_subscriptions (
+	id bigint unsigned AUTO_INCREMENT,
+	project_id bigint unsigned,
+	url varchar(2048),
+	secret varchar(64),
+	events varchar(512),
+	created_by_id bigint unsigned,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	INDEX idx_webhook_subscriptions_project_id (project_id)
+);
+
+CREATE TABLE webhook_deliveries (
+	id bigint unsigned AUTO_INCREMENT,
+	subscription_id bigint unsigned,
+	event varchar(64),
+	payload json,
+	status VARCHAR(20),
+	attempts bigint,
+	next_attempt_at datetime(3) NULL,
+	response_code bigint,
+	last_error varchar(1024),
+	delivered_at datetime(3) NULL,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	INDEX idx_webhook_deliveries_subscription_id (subscription_id),
+	INDEX idx_delivery_due (status, next_attempt_at)
+);
@@ -0,0 +1,2 @@
+DROP TABLE outbox_offsets;
+DROP TABLE outbox_events;
@@ -0,0 +1,16 @@
+CREATE TABLE outbox_events (
+	id bigint unsigned AUTO_INCREMENT,
+	name varchar(64),
+	project_id bigint unsigned,
+	payload json,
+	created_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	INDEX idx_outbox_events_created_at (created_at)
+);
+
+CREATE TABLE outbox_offsets (
+	consumer varchar(64),
+	event_id bigint unsigned,
+	updated_at datetime(3) NULL,
+	PRIMARY KEY (consumer)
+);
@@ -0,0 +1,3 @@
+-- The foreign key on issue_id needs an index once the composite one is gone.
+CREATE INDEX fk_comments_diffs_issue ON comments_diffs (issue_id);
+DROP INDEX idx_comments_diffs_issue_created ON comments_diffs;
@@ -0,0 +1,2 @@
+-- Issue history and status replay read the diffs of an issue in time order.
+CREATE INDEX idx_comments_diffs_issue_created ON comments_diffs (issue_id, created_at);
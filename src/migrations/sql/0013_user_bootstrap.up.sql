@@ -0,0 +1,6 @@
+-- Holds a single row once the first user has been created without a token.
+CREATE TABLE user_bootstrap (
+	id bigint unsigned,
+	created_at datetime(3) NULL,
+	PRIMARY KEY (id)
+);
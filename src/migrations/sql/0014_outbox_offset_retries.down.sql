@@ -0,0 +1 @@
+ALTER TABLE outbox_offsets DROP COLUMN next_run_at, DROP COLUMN attempts;
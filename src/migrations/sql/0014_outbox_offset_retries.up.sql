@@ -0,0 +1,3 @@
+ALTER TABLE outbox_offsets
+	ADD COLUMN attempts bigint NOT NULL DEFAULT 0,
+	ADD COLUMN next_run_at datetime(3) NULL;
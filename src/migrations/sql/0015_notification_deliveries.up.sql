@@ -0,0 +1,17 @@
+CREATE TABLE notification_deliveries (
+	id bigint unsigned AUTO_INCREMENT,
+	event_id bigint unsigned,
+	channel varchar(20),
+	recipient varchar(256),
+	message json,
+	status VARCHAR(20),
+	attempts bigint,
+	next_attempt_at datetime(3) NULL,
+	last_error varchar(1024),
+	delivered_at datetime(3) NULL,
+	created_at datetime(3) NULL,
+	updated_at datetime(3) NULL,
+	PRIMARY KEY (id),
+	UNIQUE INDEX idx_notification_delivery (event_id, channel, recipient),
+	INDEX idx_notification_due (status, next_attempt_at)
+);